@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"sync/atomic"
+)
+
+var maxConcurrentRuns = flag.Int("max-concurrent-runs", 2, "number of ping runs allowed at once; further /ping streams wait for a slot")
+
+// admissionControl holds one token per ping run in progress. It is built on
+// first use, after flags have been parsed.
+var admissionControl = sync.OnceValue(func() chan struct{} {
+	return make(chan struct{}, *maxConcurrentRuns)
+})
+
+// admissionQueued counts the streams waiting for a run slot.
+var admissionQueued atomic.Int32
+
+// RunQueuedEvent is sent as the run_queued SSE event when a stream has to
+// wait for a run slot. Position is 1 for the first stream in line.
+type RunQueuedEvent struct {
+	Position int `json:"position"`
+}
+
+// acquireRunSlot takes a run slot, calling queued with the stream's place in
+// line first if it has to wait. It returns false if ctx ends while waiting.
+func acquireRunSlot(ctx context.Context, queued func(position int)) bool {
+	select {
+	case admissionControl() <- struct{}{}:
+		return true
+	default:
+	}
+
+	queued(int(admissionQueued.Add(1)))
+	defer admissionQueued.Add(-1)
+	select {
+	case admissionControl() <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func releaseRunSlot() {
+	<-admissionControl()
+}
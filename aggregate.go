@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+type aggregateRequest struct {
+	Rounds               int `json:"rounds"`
+	AttemptsPerRound     int `json:"attempts_per_round"`
+	DelayBetweenRoundsMs int `json:"delay_between_rounds_ms"`
+}
+
+// RegionAggregate summarises every sample taken from one region over all
+// rounds of /api/ping/aggregate.
+type RegionAggregate struct {
+	Samples int     `json:"samples"`
+	Errors  int     `json:"errors"`
+	MinMs   float64 `json:"min_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	P99Ms   float64 `json:"p99_ms"`
+}
+
+// AggregateProgress is sent as a round_complete SSE event after each round.
+type AggregateProgress struct {
+	Round  int `json:"round"`
+	Rounds int `json:"rounds"`
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func summarise(samples []float64, errors int) RegionAggregate {
+	agg := RegionAggregate{Samples: len(samples), Errors: errors}
+	if len(samples) == 0 {
+		return agg
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	agg.MinMs = round(sorted[0])
+	agg.MaxMs = round(sorted[len(sorted)-1])
+	agg.AvgMs = round(sum / float64(len(sorted)))
+	agg.P50Ms = round(percentile(sorted, 50))
+	agg.P95Ms = round(percentile(sorted, 95))
+	agg.P99Ms = round(percentile(sorted, 99))
+	return agg
+}
+
+// runAggregate pings every region attempts times per round, over rounds
+// rounds spaced delay apart, and summarises the samples per region. progress
+// is called after each round.
+func runAggregate(ctx context.Context, req aggregateRequest, progress func(round int)) map[string]RegionAggregate {
+	var regions []awsping.AWSRegion
+	for _, region := range getRegions() {
+		if !strings.HasPrefix(region.Code, consulCodePrefix) {
+			regions = append(regions, region)
+		}
+	}
+
+	var mu sync.Mutex
+	samples := make(map[string][]float64, len(regions))
+	errors := make(map[string]int, len(regions))
+	for round := 1; round <= req.Rounds && ctx.Err() == nil; round++ {
+		var wg sync.WaitGroup
+		for _, region := range regions {
+			wg.Add(1)
+			go func(region awsping.AWSRegion) {
+				defer wg.Done()
+				for i := 0; i < req.AttemptsPerRound; i++ {
+					sample, err := pingRegion(ctx, pingHTTPClient(), region, "", nil)
+					mu.Lock()
+					if err != nil {
+						errors[region.Code]++
+					} else {
+						samples[region.Code] = append(samples[region.Code], float64(sample.latency)/float64(time.Millisecond))
+					}
+					mu.Unlock()
+				}
+			}(region)
+		}
+		wg.Wait()
+		progress(round)
+
+		if round < req.Rounds {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(req.DelayBetweenRoundsMs) * time.Millisecond):
+			}
+		}
+	}
+
+	stats := make(map[string]RegionAggregate, len(regions))
+	for _, region := range regions {
+		stats[region.Code] = summarise(samples[region.Code], errors[region.Code])
+	}
+	return stats
+}
+
+// aggregateHandler runs several rounds of pings and returns per-region
+// statistics. Clients asking for text/event-stream get a round_complete event
+// per round and the statistics as a final aggregate event.
+func aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	req := aggregateRequest{Rounds: 5, AttemptsPerRound: pingAttempts, DelayBetweenRoundsMs: 5000}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	switch {
+	case req.Rounds < 1 || req.Rounds > 100:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rounds must be between 1 and 100"})
+		return
+	case req.AttemptsPerRound < 1 || req.AttemptsPerRound > 20:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "attempts_per_round must be between 1 and 20"})
+		return
+	case req.DelayBetweenRoundsMs < 0 || req.DelayBetweenRoundsMs > 600000:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "delay_between_rounds_ms must be between 0 and 600000"})
+		return
+	}
+
+	// The whole aggregate holds one of --max-concurrent-runs slots.
+	flusher, streaming := w.(http.Flusher)
+	streaming = streaming && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if !streaming {
+		if !acquireRunSlot(r.Context(), func(int) {}) {
+			return
+		}
+		defer releaseRunSlot()
+		writeJSON(w, http.StatusOK, runAggregate(r.Context(), req, func(int) {}))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	admitted := acquireRunSlot(r.Context(), func(position int) {
+		writeSSEEvent(w, flusher, "run_queued", RunQueuedEvent{Position: position})
+	})
+	if !admitted {
+		return
+	}
+	defer releaseRunSlot()
+	stats := runAggregate(r.Context(), req, func(round int) {
+		writeSSEEvent(w, flusher, "round_complete", AggregateProgress{Round: round, Rounds: req.Rounds})
+	})
+	writeSSEEvent(w, flusher, "aggregate", stats)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type BudgetAllocation struct {
+	CDNBudgetMs    float64 `json:"cdn_budget_ms"`
+	OriginBudgetMs float64 `json:"origin_budget_ms"`
+	AppBudgetMs    float64 `json:"app_budget_ms"`
+	// RecommendedRegion is the fastest region of the last run that fits
+	// within the origin budget, or empty if none does.
+	RecommendedRegion string  `json:"recommended_region"`
+	RegionLatencyMs   float64 `json:"region_latency_ms,omitempty"`
+}
+
+// budgetAllocationHandler splits total_ms between CDN, origin and
+// application processing; the origin gets whatever cdn_pct and app_pct leave.
+func budgetAllocationHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	total, err := strconv.ParseFloat(query.Get("total_ms"), 64)
+	if err != nil || total <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "total_ms must be a positive number"})
+		return
+	}
+	cdnPct, err := strconv.ParseFloat(query.Get("cdn_pct"), 64)
+	if err != nil || cdnPct < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cdn_pct must be a non-negative number"})
+		return
+	}
+	appPct, err := strconv.ParseFloat(query.Get("app_pct"), 64)
+	if err != nil || appPct < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "app_pct must be a non-negative number"})
+		return
+	}
+	if cdnPct+appPct > 100 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cdn_pct and app_pct must not add up to more than 100"})
+		return
+	}
+
+	results, _, ok := getLastRun()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no completed ping run yet"})
+		return
+	}
+
+	allocation := BudgetAllocation{
+		CDNBudgetMs:    total * cdnPct / 100,
+		AppBudgetMs:    total * appPct / 100,
+		OriginBudgetMs: total * (100 - cdnPct - appPct) / 100,
+	}
+	for _, result := range results {
+		if result.Error != "" || result.Latency > allocation.OriginBudgetMs {
+			continue
+		}
+		if allocation.RecommendedRegion == "" || result.Latency < allocation.RegionLatencyMs {
+			allocation.RecommendedRegion = result.Code
+			allocation.RegionLatencyMs = result.Latency
+		}
+	}
+
+	writeJSON(w, http.StatusOK, allocation)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type Anomaly struct {
+	RegionCode string  `json:"region_code"`
+	Continent  string  `json:"continent"`
+	LatencyMs  float64 `json:"latency_ms"`
+	// ContinentMeanMs is the mean latency of the continent's other regions,
+	// and Deviation the distance from it in their standard deviations.
+	ContinentMeanMs float64 `json:"continent_mean_ms"`
+	Deviation       float64 `json:"deviation"`
+}
+
+// minAnomalyGroupSize is the fewest successful regions a continent needs
+// before any of them is judged against the rest.
+const minAnomalyGroupSize = 4
+
+// regionContinents maps region code prefixes to the continent they sit in.
+var regionContinents = map[string]string{
+	"us": "North America",
+	"ca": "North America",
+	"mx": "North America",
+	"sa": "South America",
+	"eu": "Europe",
+	"ap": "Asia Pacific",
+	"cn": "Asia Pacific",
+	"me": "Middle East",
+	"il": "Middle East",
+	"af": "Africa",
+}
+
+// regionContinent returns the continent of a region code, or "" if unknown.
+func regionContinent(code string) string {
+	prefix, _, _ := strings.Cut(code, "-")
+	return regionContinents[prefix]
+}
+
+// findAnomalies returns successful results whose latency lies more than two
+// standard deviations from the mean of the other regions on their continent.
+// Leaving the region out keeps a single outlier from inflating the spread it
+// is measured against, which would otherwise hide it in small continents.
+func findAnomalies(results []PingResult) []Anomaly {
+	groups := make(map[string][]PingResult)
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		if continent := regionContinent(result.Code); continent != "" {
+			groups[continent] = append(groups[continent], result)
+		}
+	}
+
+	anomalies := []Anomaly{}
+	for continent, group := range groups {
+		if len(group) < minAnomalyGroupSize {
+			continue
+		}
+		var sum, sumSquares float64
+		for _, result := range group {
+			sum += result.Latency
+			sumSquares += result.Latency * result.Latency
+		}
+
+		for _, result := range group {
+			// Sample mean and standard deviation of the other regions.
+			n := float64(len(group) - 1)
+			mean := (sum - result.Latency) / n
+			variance := (sumSquares - result.Latency*result.Latency - n*mean*mean) / (n - 1)
+			if variance <= 0 {
+				continue
+			}
+			stddev := math.Sqrt(variance)
+			if math.Abs(result.Latency-mean) > 2*stddev {
+				anomalies = append(anomalies, Anomaly{
+					RegionCode:      result.Code,
+					Continent:       continent,
+					LatencyMs:       result.Latency,
+					ContinentMeanMs: math.Round(mean*100) / 100,
+					Deviation:       math.Round((result.Latency-mean)/stddev*100) / 100,
+				})
+			}
+		}
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return math.Abs(anomalies[i].Deviation) > math.Abs(anomalies[j].Deviation)
+	})
+	return anomalies
+}
+
+func anomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	results, _, ok := getLastRun()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no completed ping run yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, findAnomalies(results))
+}
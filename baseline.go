@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	baselineOnStart = flag.Bool("baseline-on-start", false, "keep the first completed run as a permanent baseline and report every later result's change from it")
+	baselineFile    = flag.String("baseline-file", "", "file the latency baseline is loaded from, and saved to under --baseline-on-start")
+)
+
+// latencyBaseline holds the baseline latencies by region code. Once set it is
+// never replaced; remove --baseline-file to take a new one.
+var latencyBaseline struct {
+	sync.RWMutex
+	latencies map[string]float64
+}
+
+// baselineEnabled reports whether results are compared with a baseline.
+func baselineEnabled() bool {
+	return *baselineOnStart || *baselineFile != ""
+}
+
+// loadBaseline reads --baseline-file. A missing file is only an error when
+// --baseline-on-start isn't there to create it.
+func loadBaseline() error {
+	data, err := os.ReadFile(*baselineFile)
+	if errors.Is(err, os.ErrNotExist) && *baselineOnStart {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var latencies map[string]float64
+	if err := json.Unmarshal(data, &latencies); err != nil {
+		return err
+	}
+	latencyBaseline.Lock()
+	latencyBaseline.latencies = latencies
+	latencyBaseline.Unlock()
+	return nil
+}
+
+// recordBaseline makes results the baseline if there is none yet and at least
+// one region succeeded, saving it to --baseline-file when that is set.
+func recordBaseline(results []PingResult) {
+	latencies := make(map[string]float64, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			latencies[result.Code] = result.Latency
+		}
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	latencyBaseline.Lock()
+	defer latencyBaseline.Unlock()
+	if latencyBaseline.latencies != nil {
+		return
+	}
+	latencyBaseline.latencies = latencies
+	log.Printf("Recorded baseline of %d regions", len(latencies))
+	if *baselineFile == "" {
+		return
+	}
+	if data, err := json.Marshal(latencies); err != nil {
+		log.Printf("Error encoding baseline: %v", err)
+	} else if err := os.WriteFile(*baselineFile, data, 0o644); err != nil {
+		log.Printf("Error saving baseline: %v", err)
+	}
+}
+
+// baselineLatencies returns the baseline, or nil if there is none yet.
+func baselineLatencies() map[string]float64 {
+	latencyBaseline.RLock()
+	defer latencyBaseline.RUnlock()
+	return latencyBaseline.latencies
+}
+
+// setBaselineDelta records how far a successful result's latency is from the
+// region's baseline latency.
+func setBaselineDelta(result *PingResult, baseline map[string]float64) {
+	before, ok := baseline[result.Code]
+	if !ok || result.Error != "" {
+		return
+	}
+	result.BaselineDeltaMs = result.Latency - before
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bestRegionCacheTTL is how long a completed run is reused by /api/best-region
+// before a fresh one is triggered.
+const bestRegionCacheTTL = 30 * time.Second
+
+// bestRegionRun serialises the fresh runs triggered by /api/best-region so
+// concurrent callers wait for one run instead of starting their own.
+var bestRegionRun sync.Mutex
+
+type bestRegionMiss struct {
+	Message     string  `json:"message"`
+	NearestMs   float64 `json:"nearest_ms,omitempty"`
+	NearestCode string  `json:"nearest_code,omitempty"`
+}
+
+// recentResults returns the last run if it completed within
+// bestRegionCacheTTL, and otherwise runs a fresh sweep. The sweep takes a
+// run slot like a /ping stream and, once started, runs to the end even if
+// ctx ends, so only complete runs are recorded. It returns nil if ctx ends
+// while waiting for the slot.
+func recentResults(ctx context.Context) []PingResult {
+	bestRegionRun.Lock()
+	defer bestRegionRun.Unlock()
+
+	if results, completedAt, ok := getLastRun(); ok && time.Since(completedAt) < bestRegionCacheTTL {
+		return results
+	}
+
+	if !acquireRunSlot(ctx, func(int) {}) {
+		return nil
+	}
+	defer releaseRunSlot()
+
+	var completed []PingResult
+	for result := range runPings(context.Background(), getRegions(), runOptions{}) {
+		result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		completed = append(completed, result)
+	}
+	finishRun(completed)
+	return completed
+}
+
+func bestRegionHandler(w http.ResponseWriter, r *http.Request) {
+	maxLatency, err := strconv.ParseFloat(r.URL.Query().Get("max_latency_ms"), 64)
+	if err != nil || maxLatency <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "max_latency_ms must be a positive number"})
+		return
+	}
+
+	var best *PingResult
+	results := recentResults(r.Context())
+	for i := range results {
+		if results[i].Error == "" && (best == nil || results[i].Latency < best.Latency) {
+			best = &results[i]
+		}
+	}
+
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(bestRegionCacheTTL.Seconds())))
+	switch {
+	case best == nil:
+		writeJSON(w, http.StatusNotFound, bestRegionMiss{Message: "no region could be reached"})
+	case best.Latency > maxLatency:
+		writeJSON(w, http.StatusNotFound, bestRegionMiss{
+			Message:     "no region below threshold",
+			NearestMs:   best.Latency,
+			NearestCode: best.Code,
+		})
+	default:
+		writeJSON(w, http.StatusOK, best)
+	}
+}
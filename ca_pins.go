@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// awsCAPins are the hex SHA-256 digests of the SubjectPublicKeyInfo of the
+// CAs in the Amazon Trust Services hierarchy that S3 certificates chain to.
+// The roots are pinned rather than the issuing intermediates, which Amazon
+// rotates (Amazon RSA 2048 M01, M02, ...) far more often than its roots.
+var awsCAPins = map[string]string{
+	"fbe3018031f9586bcbf41727e417b7d1c45c2f47f93be372a17b96b50757d5a2": "Amazon Root CA 1",
+	"7f4296fc5b6a4e3b35d3c369623e364ab1af381d8fa7121533c9d6c633ea2461": "Amazon Root CA 2",
+	"36abc32656acfc645c61b71613c4bf21c787f5cabbee48348d58597803d7abc9": "Amazon Root CA 3",
+	"f7ecded5c66047d28ed6466b543c40e0743abe81d109254dcf845d4c2c7853c5": "Amazon Root CA 4",
+	// Starfield Services Root G2 cross-signs the Amazon roots for older
+	// trust stores.
+	"2b071c59a0a0ae76b0eadb2bad23bad4580b69c3601b630c2eaf0613afa83f92": "Starfield Services Root Certificate Authority - G2",
+}
+
+// chainPinned reports whether any certificate in chain has a pinned public
+// key.
+func chainPinned(chain []*x509.Certificate) bool {
+	for _, cert := range chain {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if _, ok := awsCAPins[hex.EncodeToString(sum[:])]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	cliMode    = flag.Bool("cli", false, "ping every region once, print the results and exit instead of serving the web UI")
+	jsonOutput = flag.Bool("json", false, "in --cli mode, print newline-delimited JSON as results arrive")
+)
+
+// exitThresholds holds the --exit-code-threshold constraints.
+var exitThresholds latencyThresholds
+
+func init() {
+	flag.Var(&exitThresholds, "exit-code-threshold", "in --cli mode, exit 1 if <region_code>:<max_ms> is exceeded (repeatable)")
+}
+
+type latencyThreshold struct {
+	code  string
+	maxMs float64
+}
+
+// latencyThresholds is a repeatable flag.Value of <region_code>:<max_ms> pairs.
+type latencyThresholds []latencyThreshold
+
+func (t *latencyThresholds) String() string {
+	parts := make([]string, len(*t))
+	for i, threshold := range *t {
+		parts[i] = fmt.Sprintf("%s:%g", threshold.code, threshold.maxMs)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *latencyThresholds) Set(value string) error {
+	code, max, ok := strings.Cut(value, ":")
+	if !ok || code == "" {
+		return fmt.Errorf("expected <region_code>:<max_ms>, got %q", value)
+	}
+	maxMs, err := strconv.ParseFloat(max, 64)
+	if err != nil || maxMs <= 0 {
+		return fmt.Errorf("invalid max_ms %q", max)
+	}
+	*t = append(*t, latencyThreshold{code: code, maxMs: maxMs})
+	return nil
+}
+
+// checkThresholds prints every violated constraint to stderr and reports
+// whether all of them held. A region that failed or was not pinged at all
+// violates its constraint.
+func checkThresholds(results []PingResult) bool {
+	byCode := make(map[string]PingResult, len(results))
+	for _, result := range results {
+		byCode[result.Code] = result
+	}
+
+	ok := true
+	for _, threshold := range exitThresholds {
+		result, found := byCode[threshold.code]
+		switch {
+		case !found:
+			fmt.Fprintf(os.Stderr, "%s: not pinged (threshold %gms)\n", threshold.code, threshold.maxMs)
+		case result.Error != "":
+			fmt.Fprintf(os.Stderr, "%s: %s (threshold %gms)\n", threshold.code, result.Error, threshold.maxMs)
+		case result.Latency > threshold.maxMs:
+			fmt.Fprintf(os.Stderr, "%s: %.2fms exceeds threshold %gms\n", threshold.code, result.Latency, threshold.maxMs)
+		default:
+			continue
+		}
+		ok = false
+	}
+	return ok
+}
+
+// cliSummary is the final JSONL line written in --cli --json mode.
+type cliSummary struct {
+	Total      int   `json:"total"`
+	Errors     int   `json:"errors"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// runCLI pings every region once and writes each result to stdout as soon
+// as it arrives. It returns the process exit code.
+func runCLI() int {
+	start := time.Now()
+	enc := json.NewEncoder(os.Stdout)
+
+	var completed []PingResult
+	errCount := 0
+	for result := range runPings(context.Background(), getRegions(), runOptions{}) {
+		result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		completed = append(completed, result)
+		if result.Error != "" {
+			errCount++
+		}
+
+		if *jsonOutput {
+			if err := enc.Encode(result); err != nil {
+				log.Printf("Error writing result: %v", err)
+				return 1
+			}
+			continue
+		}
+		if result.Error != "" {
+			fmt.Printf("%-30s %-16s %s\n", result.Region, result.Code, result.Error)
+		} else {
+			fmt.Printf("%-30s %-16s %8.2f ms\n", result.Region, result.Code, result.Latency)
+		}
+	}
+	finishRun(completed)
+	// The process exits straight after, so the webhooks must be delivered,
+	// retries included, before runCLI returns.
+	defer runIntegrations.Wait()
+
+	summary := cliSummary{
+		Total:      len(completed),
+		Errors:     errCount,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if *jsonOutput {
+		if err := enc.Encode(map[string]cliSummary{"_summary": summary}); err != nil {
+			log.Printf("Error writing summary: %v", err)
+			return 1
+		}
+	} else {
+		fmt.Printf("\n%d regions, %d errors in %d ms\n", summary.Total, summary.Errors, summary.DurationMs)
+	}
+
+	if !checkThresholds(completed) {
+		return 1
+	}
+	if errCount == len(completed) {
+		return 1
+	}
+	return 0
+}
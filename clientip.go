@@ -0,0 +1,134 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	cloudCIDRsFile = flag.String("cloud-cidrs", "", "JSON file of cloud and VPN CIDR ranges used to classify client IPs (defaults to the bundled list)")
+	vpnCIDRsFile   = flag.String("vpn-cidrs", "", "file of VPN exit CIDR ranges, one per line, added to the VPN list used to classify client IPs")
+)
+
+// bundledCloudCIDRs is a starter list of large cloud provider blocks (AWS,
+// Azure, GCP, DigitalOcean, Hetzner). It is deliberately coarse; deployments
+// that care should pass their own list, e.g. built from the providers'
+// published range files, with --cloud-cidrs. It has no VPN ranges, which
+// vary too much between providers to bundle; add them with --vpn-cidrs.
+//
+//go:embed cloud-cidrs.json
+var bundledCloudCIDRs []byte
+
+// Client IP classes reported in PingResult.ClientIPType.
+const (
+	clientIPCloud       = "cloud"
+	clientIPVPN         = "vpn"
+	clientIPResidential = "residential"
+)
+
+type ipClassifier struct {
+	cloud []*net.IPNet
+	vpn   []*net.IPNet
+}
+
+var clientIPClassifier *ipClassifier
+
+// loadIPClassifier parses a {"cloud": [...], "vpn": [...]} CIDR list.
+func loadIPClassifier(data []byte) (*ipClassifier, error) {
+	var lists struct {
+		Cloud []string `json:"cloud"`
+		VPN   []string `json:"vpn"`
+	}
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, err
+	}
+
+	var c ipClassifier
+	var err error
+	if c.cloud, err = parseCIDRs(lists.Cloud); err != nil {
+		return nil, err
+	}
+	if c.vpn, err = parseCIDRs(lists.VPN); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// loadCIDRLines reads CIDRs from path, one per line, skipping blank lines
+// and lines starting with '#'.
+func loadCIDRLines(path string) ([]*net.IPNet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			cidrs = append(cidrs, line)
+		}
+	}
+	return parseCIDRs(cidrs)
+}
+
+// initIPClassifier loads --cloud-cidrs, or the bundled list when unset, and
+// adds --vpn-cidrs to its VPN ranges.
+func initIPClassifier() error {
+	data := bundledCloudCIDRs
+	if *cloudCIDRsFile != "" {
+		var err error
+		if data, err = os.ReadFile(*cloudCIDRsFile); err != nil {
+			return err
+		}
+	}
+	c, err := loadIPClassifier(data)
+	if err != nil {
+		return err
+	}
+	if *vpnCIDRsFile != "" {
+		vpn, err := loadCIDRLines(*vpnCIDRsFile)
+		if err != nil {
+			return err
+		}
+		c.vpn = append(c.vpn, vpn...)
+	}
+	clientIPClassifier = c
+	return nil
+}
+
+// classifyClientIP returns the class of a client address, or "" when it
+// can't be classified (unparseable, private or loopback).
+func classifyClientIP(ipStr string) string {
+	ip := net.ParseIP(ipStr)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() || clientIPClassifier == nil {
+		return ""
+	}
+	for _, ipNet := range clientIPClassifier.vpn {
+		if ipNet.Contains(ip) {
+			return clientIPVPN
+		}
+	}
+	for _, ipNet := range clientIPClassifier.cloud {
+		if ipNet.Contains(ip) {
+			return clientIPCloud
+		}
+	}
+	return clientIPResidential
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// clientTimings holds browser-measured client latencies for /ping streams
+// whose ICMP client ping failed, keyed by the stream's request ID. A stream
+// is registered while it runs and picks its timing up between results.
+var clientTimings struct {
+	sync.Mutex
+	pending map[string]*float64
+}
+
+// ClientTimingUpdate is sent as the client_timing_update SSE event once the
+// browser has reported its own round trip to the server.
+type ClientTimingUpdate struct {
+	ClientPingMs float64 `json:"client_ping_ms"`
+}
+
+func registerClientTiming(requestID string) {
+	clientTimings.Lock()
+	defer clientTimings.Unlock()
+	if clientTimings.pending == nil {
+		clientTimings.pending = make(map[string]*float64)
+	}
+	clientTimings.pending[requestID] = nil
+}
+
+func unregisterClientTiming(requestID string) {
+	clientTimings.Lock()
+	defer clientTimings.Unlock()
+	delete(clientTimings.pending, requestID)
+}
+
+// takeClientTiming returns the timing reported for a stream, if any, and
+// clears it so it is only applied once.
+func takeClientTiming(requestID string) (float64, bool) {
+	clientTimings.Lock()
+	defer clientTimings.Unlock()
+	ms := clientTimings.pending[requestID]
+	if ms == nil {
+		return 0, false
+	}
+	clientTimings.pending[requestID] = nil
+	return *ms, true
+}
+
+// healthHandler answers the browser's round-trip probes as cheaply as
+// possible.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func clientTimingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+
+	var body struct {
+		RequestID    string  `json:"request_id"`
+		ClientPingMs float64 `json:"client_ping_ms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if body.ClientPingMs <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "client_ping_ms must be a positive number"})
+		return
+	}
+
+	clientTimings.Lock()
+	defer clientTimings.Unlock()
+	if _, ok := clientTimings.pending[body.RequestID]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no running stream is waiting for a client timing with that request_id"})
+		return
+	}
+	clientTimings.pending[body.RequestID] = &body.ClientPingMs
+	w.WriteHeader(http.StatusNoContent)
+}
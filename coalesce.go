@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ekalinin/awsping"
+)
+
+// sharedRun is a ping run that several /ping streams follow at once. Results
+// are kept so that streams joining late replay everything already sent.
+type sharedRun struct {
+	mu      sync.Mutex
+	results []PingResult
+	done    bool
+	// updated is closed and replaced whenever a result arrives or the run
+	// finishes.
+	updated   chan struct{}
+	followers int
+	// requestID is the leader's request ID, which the pings were sent with.
+	requestID string
+}
+
+// runsInFlight maps run keys to the run currently streaming for them. It
+// works like singleflight.Group, except that followers receive results as
+// they arrive rather than only once the run has finished.
+var runsInFlight struct {
+	sync.Mutex
+	runs map[string]*sharedRun
+}
+
+// runKey hashes the parameters that determine a run's results, so only
+// requests asking for identical runs share one.
+func runKey(regions []awsping.AWSRegion) string {
+	codes := make([]string, len(regions))
+	for i, region := range regions {
+		codes[i] = region.Code
+	}
+	params := fmt.Sprintf("%s|attempts=%d|warmup=%d|vpn=%s",
+		strings.Join(codes, ","), pingAttempts, *warmupAttempts, *vpnIP)
+	sum := sha256.Sum256([]byte(params))
+	return hex.EncodeToString(sum[:])
+}
+
+// followRun returns the in-flight run for key, if there is one.
+func followRun(key string) (*sharedRun, bool) {
+	runsInFlight.Lock()
+	defer runsInFlight.Unlock()
+
+	run, ok := runsInFlight.runs[key]
+	if ok {
+		run.mu.Lock()
+		run.followers++
+		run.mu.Unlock()
+	}
+	return run, ok
+}
+
+// joinRun returns the in-flight run for key, starting it with start if none
+// is running. leader is true for the caller that started the run, whose
+// requestID the run is then recorded under.
+func joinRun(key, requestID string, start func() <-chan PingResult) (run *sharedRun, leader bool) {
+	runsInFlight.Lock()
+	if run, ok := runsInFlight.runs[key]; ok {
+		run.mu.Lock()
+		run.followers++
+		run.mu.Unlock()
+		runsInFlight.Unlock()
+		return run, false
+	}
+
+	run = &sharedRun{updated: make(chan struct{}), requestID: requestID}
+	if runsInFlight.runs == nil {
+		runsInFlight.runs = make(map[string]*sharedRun)
+	}
+	runsInFlight.runs[key] = run
+	runsInFlight.Unlock()
+
+	// start can take a while before it returns, e.g. to prefetch DNS, and
+	// streams following the run wait on it rather than on runsInFlight.
+	go run.collect(start(), func() {
+		runsInFlight.Lock()
+		delete(runsInFlight.runs, key)
+		runsInFlight.Unlock()
+	})
+	return run, true
+}
+
+// newRun returns an unshared run fed from results.
+func newRun(results <-chan PingResult) *sharedRun {
+	run := &sharedRun{updated: make(chan struct{})}
+	go run.collect(results, nil)
+	return run
+}
+
+// collect stores results as they arrive and marks the run done once the
+// channel closes. finished, if set, is called before the run is marked done.
+func (r *sharedRun) collect(results <-chan PingResult, finished func()) {
+	for result := range results {
+		r.mu.Lock()
+		r.results = append(r.results, result)
+		close(r.updated)
+		r.updated = make(chan struct{})
+		r.mu.Unlock()
+	}
+
+	if finished != nil {
+		finished()
+	}
+
+	r.mu.Lock()
+	r.done = true
+	close(r.updated)
+	followers := r.followers
+	r.mu.Unlock()
+
+	if followers > 0 {
+		log.Printf("Coalesced %d requests into 1 run", followers+1)
+	}
+}
+
+// next returns the i-th result of the run, waiting for it if necessary. ok is
+// false once the run has finished without an i-th result or done is closed.
+func (r *sharedRun) next(i int, done <-chan struct{}) (result PingResult, ok bool) {
+	for {
+		r.mu.Lock()
+		if i < len(r.results) {
+			result = r.results[i]
+			r.mu.Unlock()
+			return result, true
+		}
+		if r.done {
+			r.mu.Unlock()
+			return PingResult{}, false
+		}
+		updated := r.updated
+		r.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-done:
+			return PingResult{}, false
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+)
+
+type compareRequest struct {
+	Snapshot []PingResult `json:"snapshot"`
+}
+
+type RegionComparison struct {
+	Code     string  `json:"code"`
+	LocalMs  float64 `json:"local_ms"`
+	RemoteMs float64 `json:"remote_ms"`
+	// DeltaMs is remote minus local; DeltaPct expresses it relative to local.
+	DeltaMs  float64 `json:"delta_ms"`
+	DeltaPct float64 `json:"delta_pct"`
+}
+
+// compareHandler diffs a foreign snapshot against the local last run, region
+// by region. Regions that failed on either side are left out.
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST with a snapshot body"})
+		return
+	}
+	var req compareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Snapshot) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": `body must be {"snapshot": [<PingResult>, ...]} with at least one result`})
+		return
+	}
+
+	results, _, ok := getLastRun()
+	if !ok {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "no completed ping run to compare against"})
+		return
+	}
+	local := make(map[string]float64, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			local[result.Code] = result.Latency
+		}
+	}
+
+	comparisons := []RegionComparison{}
+	for _, remote := range req.Snapshot {
+		localMs, ok := local[remote.Code]
+		if !ok || remote.Error != "" {
+			continue
+		}
+		comparison := RegionComparison{
+			Code:     remote.Code,
+			LocalMs:  localMs,
+			RemoteMs: remote.Latency,
+			DeltaMs:  remote.Latency - localMs,
+		}
+		if localMs > 0 {
+			comparison.DeltaPct = math.Round(comparison.DeltaMs/localMs*10000) / 100
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].Code < comparisons[j].Code
+	})
+
+	writeJSON(w, http.StatusOK, comparisons)
+}
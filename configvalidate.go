@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// secretFlags are reported as set or unset, never with their value.
+var secretFlags = map[string]bool{
+	"smtp-password":  true,
+	"webhook-secret": true,
+}
+
+type ConfigValidation struct {
+	Valid  bool              `json:"valid"`
+	Errors []string          `json:"errors"`
+	Config map[string]string `json:"config"`
+}
+
+// validateConfig checks the running configuration beyond what flag parsing
+// and the startup checks catch: references to unknown regions, malformed
+// URLs and hosts that don't resolve. There is no config file; the
+// configuration is the set of command line flags.
+func validateConfig(ctx context.Context) ConfigValidation {
+	v := ConfigValidation{Errors: []string{}, Config: make(map[string]string)}
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "<redacted>"
+		}
+		v.Config[f.Name] = value
+	})
+
+	known := make(map[string]bool)
+	for _, region := range getRegions() {
+		known[region.Code] = true
+	}
+	for _, s := range sloDefinitions {
+		if !known[s.region] {
+			v.Errors = append(v.Errors, fmt.Sprintf("--slo: unknown region %q", s.region))
+		}
+	}
+	for _, threshold := range exitThresholds {
+		if !known[threshold.code] {
+			v.Errors = append(v.Errors, fmt.Sprintf("--exit-code-threshold: unknown region %q", threshold.code))
+		}
+	}
+
+	for _, u := range []struct{ name, value string }{
+		{"doh-url", *dohURL},
+		{"egress-pricing-url", *egressPricingURL},
+		{"on-complete-webhook", *onCompleteWebhook},
+		{"rank-change-webhook", *rankChangeWebhook},
+	} {
+		if u.value != "" && !isHTTPURL(u.value) {
+			v.Errors = append(v.Errors, fmt.Sprintf("--%s: %q is not an http(s) URL", u.name, u.value))
+		}
+	}
+	for _, agent := range fleetAgents {
+		if !isHTTPURL(agent) {
+			v.Errors = append(v.Errors, fmt.Sprintf("--fleet-urls: %q is not an http(s) URL", agent))
+		}
+	}
+
+	if *smtpHost != "" {
+		if _, err := parseCron(*reportSchedule); err != nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("--report-schedule: %v", err))
+		}
+		if *smtpFrom == "" || *smtpTo == "" {
+			v.Errors = append(v.Errors, "--smtp-host needs --smtp-from and --smtp-to")
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if _, err := net.DefaultResolver.LookupHost(lookupCtx, *smtpHost); err != nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("--smtp-host: %v", err))
+		}
+		cancel()
+	}
+
+	for _, ip := range []struct{ name, value string }{{"bind-ip", *bindIP}, {"vpn-ip", *vpnIP}} {
+		if ip.value == "" {
+			continue
+		}
+		if err := validateBindIP(ip.value); err != nil {
+			v.Errors = append(v.Errors, fmt.Sprintf("--%s: %v", ip.name, err))
+		}
+	}
+
+	v.Valid = len(v.Errors) == 0
+	return v
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func configValidateHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, validateConfig(r.Context()))
+}
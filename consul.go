@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var (
+	consulAddr    = flag.String("consul-addr", "", "Consul agent address (host:port) to discover extra ping targets from")
+	consulService = flag.String("consul-service", "", "Consul service whose instances are pinged alongside the AWS regions")
+	consulRefresh = flag.Duration("consul-refresh", time.Minute, "how often the Consul service list is refreshed")
+)
+
+// consulCodePrefix marks the region codes of Consul-discovered targets.
+const consulCodePrefix = "consul-"
+
+// consulCatalogEntry is the subset of a /v1/catalog/service entry we use.
+type consulCatalogEntry struct {
+	Node           string
+	Address        string
+	ServiceID      string
+	ServiceAddress string
+	ServicePort    int
+}
+
+// consulTargets holds the most recently discovered service instances.
+var consulTargets struct {
+	sync.RWMutex
+	regions   []awsping.AWSRegion
+	endpoints map[string]string
+}
+
+// startConsulDiscovery loads the service instances once and then refreshes
+// them every --consul-refresh. Failed refreshes keep the previous list.
+func startConsulDiscovery() {
+	refresh := func() {
+		regions, endpoints, err := fetchConsulTargets()
+		if err != nil {
+			log.Printf("Error refreshing Consul service %s: %v", *consulService, err)
+			return
+		}
+		consulTargets.Lock()
+		consulTargets.regions = regions
+		consulTargets.endpoints = endpoints
+		consulTargets.Unlock()
+		log.Printf("Discovered %d instances of Consul service %s", len(regions), *consulService)
+	}
+
+	refresh()
+	go func() {
+		for range time.Tick(*consulRefresh) {
+			refresh()
+		}
+	}()
+}
+
+func fetchConsulTargets() ([]awsping.AWSRegion, map[string]string, error) {
+	catalogURL := fmt.Sprintf("http://%s/v1/catalog/service/%s", *consulAddr, url.PathEscape(*consulService))
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(catalogURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var entries []consulCatalogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, nil, fmt.Errorf("decoding catalog: %w", err)
+	}
+
+	regions := make([]awsping.AWSRegion, 0, len(entries))
+	endpoints := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		// An empty ServiceAddress means the service uses its node's address.
+		address := entry.ServiceAddress
+		if address == "" {
+			address = entry.Address
+		}
+		code := consulCodePrefix + entry.ServiceID
+		regions = append(regions, awsping.NewRegion(fmt.Sprintf("%s (%s)", entry.ServiceID, entry.Node), code))
+		endpoints[code] = "http://" + net.JoinHostPort(address, strconv.Itoa(entry.ServicePort)) + "/health"
+	}
+	return regions, endpoints, nil
+}
+
+// consulRegions returns the currently known Consul targets.
+func consulRegions() []awsping.AWSRegion {
+	consulTargets.RLock()
+	defer consulTargets.RUnlock()
+	return append([]awsping.AWSRegion(nil), consulTargets.regions...)
+}
+
+// consulEndpoint returns the health URL of a Consul target.
+func consulEndpoint(code string) (string, bool) {
+	consulTargets.RLock()
+	defer consulTargets.RUnlock()
+	endpoint, ok := consulTargets.endpoints[code]
+	return endpoint, ok
+}
+
+// consulGroupStart returns the index of the first Consul target in regions,
+// or -1 if there is none. getRegions always lists them last.
+func consulGroupStart(regions []awsping.AWSRegion) int {
+	for i, region := range regions {
+		if strings.HasPrefix(region.Code, consulCodePrefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// consulHeaderColspan returns the colspan of the Consul group header row,
+// which spans every column of the results table.
+func consulHeaderColspan(opts PageOptions) string {
+	columns := 8
+	if opts.SpeedTest {
+		columns++
+	}
+	if opts.VPN {
+		columns++
+	}
+	if opts.Baseline {
+		columns++
+	}
+	return strconv.Itoa(columns)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+type ContinentBest struct {
+	Continent  string  `json:"continent"`
+	RegionCode string  `json:"region_code"`
+	LatencyMs  float64 `json:"latency_ms"`
+}
+
+// bestPerContinent returns the fastest successful result of each continent,
+// ordered by continent name. Regions of unknown continents are left out.
+func bestPerContinent(results []PingResult) []ContinentBest {
+	best := make(map[string]PingResult)
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		continent := regionContinent(result.Code)
+		if continent == "" {
+			continue
+		}
+		if current, ok := best[continent]; !ok || result.Latency < current.Latency {
+			best[continent] = result
+		}
+	}
+
+	fastest := make([]ContinentBest, 0, len(best))
+	for continent, result := range best {
+		fastest = append(fastest, ContinentBest{
+			Continent:  continent,
+			RegionCode: result.Code,
+			LatencyMs:  result.Latency,
+		})
+	}
+	sort.Slice(fastest, func(i, j int) bool {
+		return fastest[i].Continent < fastest[j].Continent
+	})
+	return fastest
+}
+
+func bestPerContinentHandler(w http.ResponseWriter, r *http.Request) {
+	results, _, ok := getLastRun()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no completed ping run yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, bestPerContinent(results))
+}
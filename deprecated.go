@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"sync"
+)
+
+var checkDeprecated = flag.Bool("check-deprecated", false, "flag regions missing from AWS's published ip-ranges.json as possibly deprecated")
+
+// publishedRegions holds the region codes found in ip-ranges.json; it stays
+// nil until the list has been loaded.
+var publishedRegions struct {
+	sync.RWMutex
+	codes map[string]bool
+}
+
+// loadPublishedRegions reads ip-ranges.json and records the regions it
+// lists.
+func loadPublishedRegions() error {
+	ranges, err := fetchIPRanges()
+	if err != nil {
+		return err
+	}
+
+	codes := make(map[string]bool)
+	for _, prefix := range ranges.Prefixes {
+		codes[prefix.Region] = true
+	}
+	publishedRegions.Lock()
+	publishedRegions.codes = codes
+	publishedRegions.Unlock()
+
+	for _, region := range getRegions() {
+		if isDeprecatedRegion(region.Code) {
+			log.Printf("Region %s is not in ip-ranges.json and may be deprecated", region.Code)
+		}
+	}
+	return nil
+}
+
+// isDeprecatedRegion reports whether a known AWS region code is missing from
+// the published list. It is false until the list has loaded and for targets
+// that are not AWS regions.
+func isDeprecatedRegion(code string) bool {
+	if strings.HasPrefix(code, consulCodePrefix) {
+		return false
+	}
+	publishedRegions.RLock()
+	defer publishedRegions.RUnlock()
+	return publishedRegions.codes != nil && !publishedRegions.codes[code]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+// dnsPrefetchConcurrency caps the lookups in flight during a DNS prefetch.
+const dnsPrefetchConcurrency = 8
+
+// regionHostname returns the host a region is pinged on.
+func regionHostname(region awsping.AWSRegion) string {
+	u, err := url.Parse(endpointURL(region))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// prefetchDNS resolves every region's hostname up front, so that lookups
+// don't land in the first ping's latency. Hostnames that fail to resolve are
+// left out and resolved per request as usual.
+func prefetchDNS(ctx context.Context, regions []awsping.AWSRegion) map[string][]net.IP {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout())
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dnsPrefetchConcurrency)
+	resolved := make(map[string][]net.IP, len(regions))
+	for _, region := range regions {
+		host := regionHostname(region)
+		if host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			addrs, err := lookupHost(ctx, host)
+			if err != nil {
+				log.Printf("Error prefetching DNS for %s: %v", host, err)
+				return
+			}
+			ips := make([]net.IP, 0, len(addrs))
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+			mu.Lock()
+			resolved[host] = ips
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	log.Printf("DNS prefetch completed in %dms", time.Since(start).Milliseconds())
+	return resolved
+}
+
+type prefetchedIPsKey struct{}
+
+// prefetchedIPs are the addresses resolved for host ahead of a ping.
+type prefetchedIPs struct {
+	host string
+	ips  []net.IP
+}
+
+// withPrefetchedIPs makes dials to host from ctx use ips instead of a lookup.
+func withPrefetchedIPs(ctx context.Context, host string, ips []net.IP) context.Context {
+	if len(ips) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, prefetchedIPsKey{}, prefetchedIPs{host: host, ips: ips})
+}
+
+// dialPrefetched wraps dial so that it connects straight to prefetched
+// addresses when the context carries some for the host being dialed, or else
+// to the addresses --doh-url resolves. If none of them connect, it falls back
+// to dialing the hostname.
+func dialPrefetched(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		var ips []net.IP
+		if prefetched, ok := ctx.Value(prefetchedIPsKey{}).(prefetchedIPs); ok && host == prefetched.host {
+			ips = prefetched.ips
+		} else if dohResolver != nil {
+			addrs, err := lookupHost(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+		}
+
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var dnsResolvers = flag.String("dns-resolvers", "", "comma-separated resolver IPs, e.g. 8.8.8.8,1.1.1.1, to resolve each region through and compare")
+
+// resolverIPs holds the parsed --dns-resolvers.
+var resolverIPs []string
+
+// resolverPingAttempts is how many pings each distinct resolved address
+// gets; the first usually pays for the handshakes.
+const resolverPingAttempts = 2
+
+// ResolverAnswer is the address one --dns-resolvers resolver returned for a
+// region and, when the resolvers disagreed, the fastest ping to it.
+type ResolverAnswer struct {
+	Resolver  string   `json:"resolver"`
+	IP        string   `json:"ip,omitempty"`
+	LatencyMs *float64 `json:"latencyMs,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// parseResolvers splits --dns-resolvers into resolver IPs.
+func parseResolvers(value string) ([]string, error) {
+	var resolvers []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if net.ParseIP(field) == nil {
+			return nil, fmt.Errorf("invalid resolver IP %q", field)
+		}
+		resolvers = append(resolvers, field)
+	}
+	return resolvers, nil
+}
+
+// resolverFor returns a resolver that sends every query to server on port
+// 53, bypassing the system configuration.
+func resolverFor(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := &net.Dialer{Timeout: connectTimeout()}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+}
+
+// compareResolvers resolves the region's hostname through every resolver.
+// If they don't all return the same address, each distinct address is
+// pinged on its own so the latencies show whether the choice of resolver
+// matters. S3 rotates addresses between queries, so differing answers alone
+// are common; similar latencies mean they reach the same place.
+func compareResolvers(ctx context.Context, region awsping.AWSRegion, resolvers []string) (answers []ResolverAnswer, variance bool) {
+	host := regionHostname(region)
+	answers = make([]ResolverAnswer, len(resolvers))
+	lookupCtx, cancel := context.WithTimeout(ctx, connectTimeout())
+	var wg sync.WaitGroup
+	for i, server := range resolvers {
+		answers[i].Resolver = server
+		wg.Add(1)
+		go func(answer *ResolverAnswer) {
+			defer wg.Done()
+			ips, err := resolverFor(answer.Resolver).LookupIP(lookupCtx, "ip4", host)
+			if err != nil {
+				answer.Error = err.Error()
+				return
+			}
+			answer.IP = ips[0].String()
+		}(&answers[i])
+	}
+	wg.Wait()
+	cancel()
+
+	distinct := make(map[string]*float64)
+	for _, answer := range answers {
+		if answer.IP != "" {
+			distinct[answer.IP] = nil
+		}
+	}
+	if len(distinct) < 2 {
+		return answers, false
+	}
+
+	for ip := range distinct {
+		distinct[ip] = pingAddress(ctx, region, net.ParseIP(ip))
+	}
+	for i := range answers {
+		if answers[i].IP != "" {
+			answers[i].LatencyMs = distinct[answers[i].IP]
+		}
+	}
+	return answers, true
+}
+
+// pingAddress pings the region at one address over a fresh client, so no
+// pooled connection to another address is reused, and returns the fastest
+// ping that really went to ip.
+func pingAddress(ctx context.Context, region awsping.AWSRegion, ip net.IP) *float64 {
+	client := newPingClient(*bindIP)
+	defer client.CloseIdleConnections()
+
+	var fastest time.Duration
+	for i := 0; i < resolverPingAttempts; i++ {
+		sample, err := pingRegion(ctx, client, region, "", []net.IP{ip})
+		if err != nil || !ip.Equal(sample.remoteIP) {
+			continue
+		}
+		if fastest == 0 || sample.latency < fastest {
+			fastest = sample.latency
+		}
+	}
+	if fastest == 0 {
+		return nil
+	}
+	ms := float64(fastest) / float64(time.Millisecond)
+	return &ms
+}
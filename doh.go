@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var dohURL = flag.String("doh-url", "", "DNS over HTTPS endpoint used to resolve region hostnames, e.g. https://cloudflare-dns.com/dns-query")
+
+// dohResolver sends lookups to --doh-url; it is nil when the flag is unset.
+var dohResolver *net.Resolver
+
+func initDoH() {
+	if *dohURL == "" {
+		return
+	}
+	dohResolver = &net.Resolver{
+		PreferGo: true,
+		Dial:     dohDialer(*dohURL),
+	}
+}
+
+// lookupHost resolves host through DoH when configured, falling back to the
+// system resolver if that fails.
+func lookupHost(ctx context.Context, host string) ([]string, error) {
+	if dohResolver != nil {
+		addrs, err := dohResolver.LookupHost(ctx, host)
+		if err == nil {
+			return addrs, nil
+		}
+		log.Printf("Error resolving %s over DoH, falling back to the system resolver: %v", host, err)
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dohDialer returns a net.Resolver Dial function whose connections carry
+// each DNS message to dohURL as an RFC 8484 POST instead of to addr.
+func dohDialer(dohURL string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	client := &http.Client{
+		Timeout: time.Second * 5,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return &dohConn{ctx: ctx, url: dohURL, client: client}, nil
+	}
+}
+
+// dohConn is a net.Conn over which the Go resolver speaks DNS in TCP framing:
+// every message is preceded by its two-byte length. It is not a
+// net.PacketConn, so the resolver uses that framing whatever the network.
+type dohConn struct {
+	ctx    context.Context
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	deadline time.Time
+	query    bytes.Buffer
+	response bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query.Write(b)
+	return len(b), nil
+}
+
+// Read sends the buffered query on the first read and then returns the
+// framed answer.
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response.Len() == 0 && c.query.Len() > 0 {
+		if err := c.exchange(); err != nil {
+			return 0, err
+		}
+	}
+	if c.response.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.response.Read(b)
+}
+
+func (c *dohConn) exchange() error {
+	framed := c.query.Bytes()
+	if len(framed) < 2 || int(binary.BigEndian.Uint16(framed)) != len(framed)-2 {
+		return fmt.Errorf("incomplete DNS query")
+	}
+	msg := framed[2:]
+	c.query.Reset()
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return err
+	}
+
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(answer)))
+	c.response.Write(length[:])
+	c.response.Write(answer)
+	return nil
+}
+
+func (c *dohConn) Close() error { return nil }
+
+func (c *dohConn) LocalAddr() net.Addr  { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr{} }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ec2TokenURL  = "http://169.254.169.254/latest/api/token"
+	ec2RegionURL = "http://169.254.169.254/latest/meta-data/placement/region"
+)
+
+// serverRegion is the AWS region the server runs in, read from the EC2
+// instance metadata at startup. It stays empty when not running on EC2.
+var serverRegion string
+
+// loadEC2Region reads the instance's region from the metadata service. An
+// IMDSv2 session token is requested first so instances that disable IMDSv1
+// still answer; if the token request is refused the plain IMDSv1 request is
+// sent. Off EC2 the token request fails to connect and nothing else is tried.
+func loadEC2Region() (string, error) {
+	client := &http.Client{
+		Timeout: 500 * time.Millisecond,
+	}
+
+	tokenReq, err := http.NewRequest("PUT", ec2TokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	tokenResp, err := client.Do(tokenReq)
+	if err != nil {
+		return "", err
+	}
+	token, _ := io.ReadAll(io.LimitReader(tokenResp.Body, 1024))
+	tokenResp.Body.Close()
+
+	req, err := http.NewRequest("GET", ec2RegionURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if tokenResp.StatusCode == http.StatusOK {
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata endpoint returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
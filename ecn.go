@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/url"
+
+	"github.com/ekalinin/awsping"
+)
+
+var ecnCheck = flag.Bool("ecn-check", false, "open a TCP connection to each region and report whether ECN was negotiated (Linux only)")
+
+// errECNUnavailable is returned where the kernel doesn't report whether a
+// connection negotiated ECN.
+var errECNUnavailable = errors.New("ECN detection is only supported on Linux")
+
+// checkECN opens a TCP connection to the region's endpoint and reports
+// whether the handshake negotiated ECN, i.e. the SYN-ACK echoed it. Linux
+// has no per-socket switch to request ECN; outgoing SYNs only ask for it
+// when the net.ipv4.tcp_ecn sysctl is 1 or the route has "features ecn".
+func checkECN(ctx context.Context, region awsping.AWSRegion) (bool, error) {
+	u, err := url.Parse(endpointURL(region))
+	if err != nil {
+		return false, err
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout()}
+	if *bindIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(*bindIP)}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return ecnNegotiated(conn.(*net.TCPConn))
+}
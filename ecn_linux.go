@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpiOptECN is TCPI_OPT_ECN from linux/tcp.h: the connection negotiated ECN.
+const tcpiOptECN = 0x08
+
+var warnECNSysctl sync.Once
+
+// ecnNegotiated reads the connection's TCP_INFO options.
+func ecnNegotiated(conn *net.TCPConn) (bool, error) {
+	warnECNSysctl.Do(func() {
+		if data, err := os.ReadFile("/proc/sys/net/ipv4/tcp_ecn"); err == nil && strings.TrimSpace(string(data)) != "1" {
+			log.Printf("net.ipv4.tcp_ecn is %s, so outgoing connections only use ECN on routes with \"features ecn\"", strings.TrimSpace(string(data)))
+		}
+	})
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var info *unix.TCPInfo
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil {
+		return false, err
+	}
+	if sockErr != nil {
+		return false, sockErr
+	}
+	return info.Options&tcpiOptECN != 0, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+func ecnNegotiated(conn *net.TCPConn) (bool, error) {
+	return false, errECNUnavailable
+}
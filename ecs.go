@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ecsMetadata = flag.Bool("ecs-metadata", false, "read the ECS task metadata endpoint at startup and source ICMP pings from the task's own IP")
+
+const ecsMetadataURL = "http://169.254.170.2/v2/metadata"
+
+type ecsTaskMetadata struct {
+	Cluster    string `json:"Cluster"`
+	TaskARN    string `json:"TaskARN"`
+	VPCID      string `json:"VPCID"`
+	Containers []struct {
+		Name     string `json:"Name"`
+		Networks []struct {
+			NetworkMode         string   `json:"NetworkMode"`
+			IPv4Addresses       []string `json:"IPv4Addresses"`
+			IPv4SubnetCIDRBlock string   `json:"IPv4SubnetCIDRBlock"`
+			SubnetID            string   `json:"SubnetId"`
+		} `json:"Networks"`
+	} `json:"Containers"`
+}
+
+// containerIP returns the first IPv4 address assigned to any of the task's
+// containers, along with the subnet it belongs to when the endpoint reports it.
+func (m *ecsTaskMetadata) containerIP() (ip, subnet string, ok bool) {
+	for _, container := range m.Containers {
+		for _, network := range container.Networks {
+			if len(network.IPv4Addresses) > 0 {
+				subnet = network.SubnetID
+				if subnet == "" {
+					subnet = network.IPv4SubnetCIDRBlock
+				}
+				return network.IPv4Addresses[0], subnet, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func loadECSMetadata() (*ecsTaskMetadata, error) {
+	client := &http.Client{
+		Timeout: time.Second * 2,
+	}
+	resp, err := client.Get(ecsMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("task metadata endpoint returned %s", resp.Status)
+	}
+
+	var metadata ecsTaskMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("decoding task metadata: %w", err)
+	}
+	return &metadata, nil
+}
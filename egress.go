@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var egressPricingURL = flag.String("egress-pricing-url", "", "URL of a JSON object mapping region codes to data transfer out prices in USD per GB, used to estimate --speed-test egress costs")
+
+// egressPricing holds the prices loaded from --egress-pricing-url; it stays
+// nil until they have been loaded.
+var egressPricing struct {
+	sync.RWMutex
+	usdPerGB map[string]float64
+}
+
+// loadEgressPricing fetches the per-region egress prices.
+func loadEgressPricing() error {
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Get(*egressPricingURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("egress pricing URL returned %s", resp.Status)
+	}
+	var prices map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return fmt.Errorf("decoding egress pricing: %w", err)
+	}
+
+	egressPricing.Lock()
+	egressPricing.usdPerGB = prices
+	egressPricing.Unlock()
+	return nil
+}
+
+// egressCostPer100GB returns the cost of sending 100 GB out of a region, or
+// false if there is no price for it.
+func egressCostPer100GB(code string) (float64, bool) {
+	egressPricing.RLock()
+	defer egressPricing.RUnlock()
+	price, ok := egressPricing.usdPerGB[code]
+	if !ok {
+		return 0, false
+	}
+	return math.Round(price*100*100) / 100, true
+}
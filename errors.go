@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Error classes reported in PingResult.ErrorType.
+const (
+	errorTypeNone              = "none"
+	errorTypeDNS               = "dns"
+	errorTypeTimeout           = "timeout"
+	errorTypeConnectionTimeout = "connection_timeout"
+	errorTypeResponseTimeout   = "response_timeout"
+	errorTypeConnectionRefused = "connection_refused"
+	errorTypeTLS               = "tls"
+	errorTypeHTTP              = "http_error"
+	errorTypeUnknown           = "unknown"
+)
+
+// regionTimeoutError reports that a region used up its whole deadline.
+type regionTimeoutError struct {
+	after time.Duration
+}
+
+func (e *regionTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.after)
+}
+
+func (e *regionTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// classifyError maps an error to one of the errorType constants so clients
+// don't have to parse OS-specific error strings.
+func classifyError(err error) string {
+	if err == nil {
+		return errorTypeNone
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errorTypeDNS
+	}
+
+	var regionErr *regionTimeoutError
+	if errors.As(err, &regionErr) {
+		return errorTypeTimeout
+	}
+
+	// A timed out dial is --connect-timeout-ms firing. Otherwise an HTTP
+	// client timeout is --response-timeout-ms; the client's timeout error
+	// also matches context.DeadlineExceeded, so it has to be checked first.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return errorTypeConnectionTimeout
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Timeout() {
+		return errorTypeResponseTimeout
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return errorTypeTimeout
+	}
+
+	// Go reports refused dials as a "dial" OpError wrapping ECONNREFUSED;
+	// "connect" covers callers that construct the OpError themselves.
+	if errors.Is(err, syscall.ECONNREFUSED) || (errors.As(err, &opErr) && opErr.Op == "connect") {
+		return errorTypeConnectionRefused
+	}
+
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &alertErr) || errors.As(err, &certErr) ||
+		errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) {
+		return errorTypeTLS
+	}
+
+	// Anything else the HTTP client reported without an underlying network
+	// error is a protocol-level failure (bad response, redirect loop, ...).
+	if errors.As(err, &urlErr) && !errors.As(err, &opErr) {
+		return errorTypeHTTP
+	}
+
+	return errorTypeUnknown
+}
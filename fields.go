@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// pingResultFields maps each PingResult JSON field name to its struct field
+// index.
+var pingResultFields = func() map[string]int {
+	t := reflect.TypeOf(PingResult{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// parseFields splits a ?fields= value and checks every name against
+// PingResult's JSON fields. An empty value selects all fields (nil).
+func parseFields(param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := pingResultFields[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// filterFields projects result onto the requested JSON fields. Fields are
+// included even when they hold their zero value.
+func filterFields(result PingResult, fields []string) map[string]interface{} {
+	v := reflect.ValueOf(result)
+	projected := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		projected[name] = v.Field(pingResultFields[name]).Interface()
+	}
+	return projected
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// firewallCheckConcurrency bounds how many connections /api/firewall-check
+// has open at once.
+const firewallCheckConcurrency = 8
+
+// FirewallCheck is the response of GET /api/firewall-check. BlockedSample
+// names one address that couldn't be reached, if any.
+type FirewallCheck struct {
+	IPsTested     int    `json:"ips_tested"`
+	IPsReachable  int    `json:"ips_reachable"`
+	BlockedSample string `json:"blocked_sample,omitempty"`
+}
+
+// representativeS3IPs picks one address per region from its first IPv4 S3
+// prefix in ip-ranges.json: the first host after the network address.
+func representativeS3IPs(ranges *ipRanges) map[string]net.IP {
+	ips := make(map[string]net.IP)
+	for _, prefix := range ranges.Prefixes {
+		if prefix.Service != "S3" || ips[prefix.Region] != nil {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(prefix.IPPrefix)
+		if err != nil {
+			continue
+		}
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		host := make(net.IP, len(ip))
+		copy(host, ip)
+		if ones, _ := ipNet.Mask.Size(); ones < 32 {
+			host[3]++
+		}
+		ips[prefix.Region] = host
+	}
+	return ips
+}
+
+// firewallCheckHandler tries a TCP connection to port 443 on a published S3
+// address in every region, so firewall rules for AWS's ranges can be checked
+// without going through the S3 hostnames or starting a ping run.
+func firewallCheckHandler(w http.ResponseWriter, r *http.Request) {
+	ranges, err := fetchIPRanges()
+	if err != nil {
+		log.Printf("Error fetching AWS IP ranges: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "could not load AWS IP ranges: " + err.Error()})
+		return
+	}
+	ips := representativeS3IPs(ranges)
+	regions := make([]string, 0, len(ips))
+	for region := range ips {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	dialer := &net.Dialer{Timeout: connectTimeout()}
+	if *bindIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(*bindIP)}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, firewallCheckConcurrency)
+	blocked := make(map[string]string)
+	check := FirewallCheck{IPsTested: len(regions)}
+	for _, region := range regions {
+		addr := net.JoinHostPort(ips[region].String(), "443")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			conn, err := dialer.DialContext(r.Context(), "tcp", addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				blocked[region] = addr
+				return
+			}
+			conn.Close()
+			check.IPsReachable++
+		}()
+	}
+	wg.Wait()
+
+	// Report the first blocked region alphabetically, so repeated checks
+	// name the same one.
+	for _, region := range regions {
+		if addr, ok := blocked[region]; ok {
+			check.BlockedSample = addr + " (" + region + ")"
+			break
+		}
+	}
+	log.Printf("Firewall check: %d of %d S3 addresses reachable", check.IPsReachable, check.IPsTested)
+	writeJSON(w, http.StatusOK, check)
+}
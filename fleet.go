@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	fleetURLs    = flag.String("fleet-urls", "", "file listing agent base URLs, one per line, to aggregate at /api/fleet")
+	fleetTimeout = flag.Duration("fleet-timeout", 30*time.Second, "timeout for collecting snapshots from fleet agents")
+)
+
+// fleetAgents is the list of agent base URLs loaded from --fleet-urls.
+var fleetAgents []string
+
+type FleetAgentResult struct {
+	Results []PingResult `json:"results,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type FleetResponse struct {
+	Agents map[string]FleetAgentResult `json:"agents"`
+	// Consensus is the median latency in milliseconds per region code across
+	// every agent that reached it.
+	Consensus map[string]float64 `json:"consensus"`
+}
+
+// loadFleetURLs reads agent base URLs from path, skipping blank lines and
+// lines starting with '#'.
+func loadFleetURLs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, strings.TrimSuffix(line, "/"))
+	}
+	return urls, scanner.Err()
+}
+
+// snapshotHandler serves the last completed run as a JSON array, which is
+// the contract fleet agents are polled with.
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	results, _, ok := getLastRun()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no completed ping run yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func fetchSnapshot(ctx context.Context, agent string) ([]PingResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", agent+"/api/snapshot", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var results []PingResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	return results, nil
+}
+
+func fleetHandler(w http.ResponseWriter, r *http.Request) {
+	if len(fleetAgents) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no fleet agents configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), *fleetTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	agents := make(map[string]FleetAgentResult, len(fleetAgents))
+	for _, agent := range fleetAgents {
+		wg.Add(1)
+		go func(agent string) {
+			defer wg.Done()
+
+			var result FleetAgentResult
+			results, err := fetchSnapshot(ctx, agent)
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				result.Error = "timeout"
+			case err != nil:
+				result.Error = err.Error()
+			default:
+				result.Results = results
+			}
+
+			mu.Lock()
+			agents[agent] = result
+			mu.Unlock()
+		}(agent)
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, FleetResponse{
+		Agents:    agents,
+		Consensus: fleetConsensus(agents),
+	})
+}
+
+// fleetConsensus returns the median successful latency per region.
+func fleetConsensus(agents map[string]FleetAgentResult) map[string]float64 {
+	samples := make(map[string][]float64)
+	for _, agent := range agents {
+		for _, result := range agent.Results {
+			if result.Error == "" {
+				samples[result.Code] = append(samples[result.Code], result.Latency)
+			}
+		}
+	}
+
+	consensus := make(map[string]float64, len(samples))
+	for code, latencies := range samples {
+		sort.Float64s(latencies)
+		mid := len(latencies) / 2
+		if len(latencies)%2 == 0 {
+			consensus[code] = (latencies[mid-1] + latencies[mid]) / 2
+		} else {
+			consensus[code] = latencies[mid]
+		}
+	}
+	return consensus
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+var geoFenceBaselineFile = flag.String("geo-fence-baseline-file", "", "file the geo-fence latency baseline is kept in across restarts")
+
+// geoFenceMinCorrelation is the Pearson correlation with the baseline below
+// which the server is assumed to have moved.
+const geoFenceMinCorrelation = 0.7
+
+// geoFenceBaseline holds the latencies of the first successful run, by region
+// code. Later runs are compared against it; it is never replaced, so after a
+// move every run reports the change until the baseline file is removed.
+var geoFenceBaseline struct {
+	sync.Mutex
+	latencies map[string]float64
+}
+
+// LocationChange is sent as the server_location_changed SSE event.
+type LocationChange struct {
+	Correlation    float64  `json:"correlation"`
+	BaselineTop    []string `json:"baseline_top"`
+	CurrentTop     []string `json:"current_top"`
+	BaselineBottom []string `json:"baseline_bottom"`
+	CurrentBottom  []string `json:"current_bottom"`
+}
+
+// loadGeoFenceBaseline reads --geo-fence-baseline-file if it exists.
+func loadGeoFenceBaseline() error {
+	data, err := os.ReadFile(*geoFenceBaselineFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var latencies map[string]float64
+	if err := json.Unmarshal(data, &latencies); err != nil {
+		return err
+	}
+	geoFenceBaseline.Lock()
+	geoFenceBaseline.latencies = latencies
+	geoFenceBaseline.Unlock()
+	return nil
+}
+
+// checkGeoFence compares a run with the baseline, establishing the baseline
+// from it if there is none yet. It returns the change when the latencies
+// correlate poorly with the baseline or the three fastest or slowest regions
+// differ, and nil otherwise.
+func checkGeoFence(results []PingResult) *LocationChange {
+	current := make(map[string]float64, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			current[result.Code] = result.Latency
+		}
+	}
+
+	geoFenceBaseline.Lock()
+	defer geoFenceBaseline.Unlock()
+	if geoFenceBaseline.latencies == nil {
+		if len(current) == 0 {
+			return nil
+		}
+		geoFenceBaseline.latencies = current
+		if *geoFenceBaselineFile != "" {
+			if data, err := json.Marshal(current); err != nil {
+				log.Printf("Error encoding geo-fence baseline: %v", err)
+			} else if err := os.WriteFile(*geoFenceBaselineFile, data, 0o644); err != nil {
+				log.Printf("Error saving geo-fence baseline: %v", err)
+			}
+		}
+		return nil
+	}
+
+	// Only regions in both runs are compared, so a region failing once
+	// doesn't look like a move.
+	var codes []string
+	for code := range current {
+		if _, ok := geoFenceBaseline.latencies[code]; ok {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) < 6 {
+		return nil
+	}
+	baseline := make([]float64, len(codes))
+	now := make([]float64, len(codes))
+	for i, code := range codes {
+		baseline[i] = geoFenceBaseline.latencies[code]
+		now[i] = current[code]
+	}
+
+	change := &LocationChange{Correlation: math.Round(pearson(baseline, now)*1000) / 1000}
+	change.BaselineTop, change.BaselineBottom = extremes(codes, geoFenceBaseline.latencies)
+	change.CurrentTop, change.CurrentBottom = extremes(codes, current)
+	if change.Correlation >= geoFenceMinCorrelation &&
+		sameSet(change.BaselineTop, change.CurrentTop) && sameSet(change.BaselineBottom, change.CurrentBottom) {
+		return nil
+	}
+	log.Printf("Warning: server location may have changed: correlation with baseline %.3f, fastest %v (was %v), slowest %v (was %v)",
+		change.Correlation, change.CurrentTop, change.BaselineTop, change.CurrentBottom, change.BaselineBottom)
+	return change
+}
+
+// pearson returns the Pearson correlation coefficient of x and y, or 0 when
+// either has no variance.
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX, varY float64
+	for i := range x {
+		cov += (x[i] - meanX) * (y[i] - meanY)
+		varX += (x[i] - meanX) * (x[i] - meanX)
+		varY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varX*varY)
+}
+
+// extremes returns the three fastest and three slowest of codes.
+func extremes(codes []string, latencies map[string]float64) (top, bottom []string) {
+	sorted := append([]string(nil), codes...)
+	sort.Slice(sorted, func(i, j int) bool { return latencies[sorted[i]] < latencies[sorted[j]] })
+	return sorted[:3], sorted[len(sorted)-3:]
+}
+
+func sameSet(a, b []string) bool {
+	seen := make(map[string]bool, len(a))
+	for _, v := range a {
+		seen[v] = true
+	}
+	for _, v := range b {
+		if !seen[v] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
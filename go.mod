@@ -5,11 +5,8 @@ go 1.23.0
 toolchain go1.23.8
 
 require (
+	github.com/a-h/templ v0.3.857
 	github.com/ekalinin/awsping v1.9.999999
 	golang.org/x/net v0.39.0
-)
-
-require (
-	github.com/a-h/templ v0.3.857 // indirect
-	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/sys v0.32.0
 )
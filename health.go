@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var checkAWSHealth = flag.Bool("check-aws-health", false, "look up S3's status in each region on the AWS Service Health Dashboard")
+
+// Values of PingResult.ServiceHealth.
+const (
+	serviceHealthy       = "healthy"
+	serviceDegraded      = "degraded"
+	serviceDisrupted     = "disrupted"
+	serviceHealthUnknown = "unknown"
+)
+
+// healthCacheTTL is how long a region's dashboard status is reused, so
+// back-to-back runs don't refetch every feed.
+const healthCacheTTL = 5 * time.Second
+
+// serviceHealthStatus is a region's S3 status and, unless it is healthy, the
+// title of the latest dashboard entry.
+type serviceHealthStatus struct {
+	status   string
+	incident string
+	fetched  time.Time
+}
+
+var serviceHealthCache struct {
+	sync.Mutex
+	regions map[string]serviceHealthStatus
+}
+
+var healthClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{Timeout: 5 * time.Second}
+})
+
+// startHealthCheck looks up the region's S3 status in the background while
+// it is pinged. The returned channel is nil when --check-aws-health is off
+// or the target is not an AWS region.
+func startHealthCheck(ctx context.Context, code string) <-chan serviceHealthStatus {
+	if !*checkAWSHealth || strings.HasPrefix(code, consulCodePrefix) {
+		return nil
+	}
+	status := make(chan serviceHealthStatus, 1)
+	go func() {
+		status <- serviceHealth(ctx, code)
+	}()
+	return status
+}
+
+// applyServiceHealth waits for a health check started by startHealthCheck
+// and records it on the result.
+func applyServiceHealth(result *PingResult, status <-chan serviceHealthStatus) {
+	if status == nil {
+		return
+	}
+	health := <-status
+	result.ServiceHealth = health.status
+	result.ServiceHealthIncident = health.incident
+}
+
+func serviceHealth(ctx context.Context, code string) serviceHealthStatus {
+	serviceHealthCache.Lock()
+	cached, ok := serviceHealthCache.regions[code]
+	serviceHealthCache.Unlock()
+	if ok && time.Since(cached.fetched) < healthCacheTTL {
+		return cached
+	}
+
+	health, err := fetchServiceHealth(ctx, code)
+	if err != nil {
+		// Failures aren't cached, so the next run tries again.
+		log.Printf("Error checking AWS health for %s: %v", code, err)
+		return serviceHealthStatus{status: serviceHealthUnknown}
+	}
+	health.fetched = time.Now()
+
+	serviceHealthCache.Lock()
+	defer serviceHealthCache.Unlock()
+	if serviceHealthCache.regions == nil {
+		serviceHealthCache.regions = make(map[string]serviceHealthStatus)
+	}
+	serviceHealthCache.regions[code] = health
+	return health
+}
+
+// healthFeed is the part of a dashboard RSS feed this server uses. Items
+// are newest first.
+type healthFeed struct {
+	Items []struct {
+		Title string `xml:"title"`
+	} `xml:"channel>item"`
+}
+
+// fetchServiceHealth reads the dashboard's RSS feed for S3 in the region.
+func fetchServiceHealth(ctx context.Context, code string) (serviceHealthStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://status.aws.amazon.com/rss/s3-"+code+".rss", nil)
+	if err != nil {
+		return serviceHealthStatus{}, err
+	}
+	resp, err := healthClient().Do(req)
+	if err != nil {
+		return serviceHealthStatus{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return serviceHealthStatus{}, fmt.Errorf("health feed returned %s", resp.Status)
+	}
+
+	var feed healthFeed
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return serviceHealthStatus{}, fmt.Errorf("decoding health feed: %w", err)
+	}
+	if len(feed.Items) == 0 {
+		return serviceHealthStatus{status: serviceHealthy}, nil
+	}
+	health := serviceHealthStatus{status: classifyHealthTitle(feed.Items[0].Title)}
+	if health.status != serviceHealthy {
+		health.incident = feed.Items[0].Title
+	}
+	return health, nil
+}
+
+// classifyHealthTitle maps the latest dashboard entry to a status. Entries
+// are titled by severity, e.g. "Informational message: ...", "Service
+// degradation: ..." or "Service disruption: ...", and the final update for
+// an event is "[RESOLVED] ..." or "Service is operating normally: ...".
+func classifyHealthTitle(title string) string {
+	lower := strings.ToLower(title)
+	switch {
+	case strings.HasPrefix(lower, "[resolved]"), strings.HasPrefix(lower, "service is operating normally"):
+		return serviceHealthy
+	case strings.Contains(lower, "disruption"):
+		return serviceDisrupted
+	default:
+		return serviceDegraded
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// historyLength is how many runs of latency history are kept per region.
+const historyLength = 100
+
+// latencyHistory holds each region's latencies over the last historyLength
+// completed runs, oldest first. A nil entry is a run in which the region
+// failed. It lives in memory only and starts empty with the server.
+var latencyHistory struct {
+	sync.RWMutex
+	regions map[string][]*float64
+}
+
+func recordHistory(results []PingResult) {
+	latencyHistory.Lock()
+	defer latencyHistory.Unlock()
+	if latencyHistory.regions == nil {
+		latencyHistory.regions = make(map[string][]*float64)
+	}
+	for _, result := range results {
+		var latency *float64
+		if result.Error == "" {
+			latency = &result.Latency
+		}
+		history := append(latencyHistory.regions[result.Code], latency)
+		if len(history) > historyLength {
+			history = history[len(history)-historyLength:]
+		}
+		latencyHistory.regions[result.Code] = history
+	}
+}
+
+// sparklineHandler returns a region's last n latencies as a JSON array, with
+// null for failed runs.
+func sparklineHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code := query.Get("region")
+	if code == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "region is required"})
+		return
+	}
+	n := 10
+	if v := query.Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 || n > historyLength {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "n must be between 1 and " + strconv.Itoa(historyLength)})
+			return
+		}
+	}
+
+	latencyHistory.RLock()
+	history := latencyHistory.regions[code]
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+	samples := append([]*float64{}, history...)
+	latencyHistory.RUnlock()
+
+	writeJSON(w, http.StatusOK, samples)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ekalinin/awsping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// errICMPUnavailable is returned once raw ICMP sockets are known not to work,
+// typically because the process lacks root or CAP_NET_RAW.
+var errICMPUnavailable = errors.New("raw ICMP sockets unavailable")
+
+var (
+	icmpRegionOnce      sync.Once
+	icmpRegionAvailable bool
+	icmpRegionSeq       atomic.Uint32
+)
+
+// icmpAvailable reports whether raw ICMP sockets can be opened, logging the
+// reason the first time they can't.
+func icmpAvailable() bool {
+	icmpRegionOnce.Do(func() {
+		c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if err != nil {
+			log.Printf("Raw ICMP unavailable, skipping region ICMP pings: %v", err)
+			return
+		}
+		c.Close()
+		icmpRegionAvailable = true
+	})
+	return icmpRegionAvailable
+}
+
+// icmpPingRegion resolves the region's S3 hostname and times a single raw
+// ICMP echo to it. Raw sockets need root or CAP_NET_RAW; when they can't be
+// opened this is logged once and every later call returns errICMPUnavailable.
+// The reply is waited for no longer than the response timeout or ctx's
+// deadline, whichever comes first.
+func icmpPingRegion(ctx context.Context, region awsping.AWSRegion) (time.Duration, error) {
+	if !icmpAvailable() {
+		return 0, errICMPUnavailable
+	}
+
+	u, err := url.Parse(endpointURL(region))
+	if err != nil {
+		return 0, err
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", u.Hostname())
+	if err != nil {
+		return 0, err
+	}
+	dst := addrs[0]
+
+	listenAddr := "0.0.0.0"
+	if icmpSourceIP != "" {
+		listenAddr = icmpSourceIP
+	}
+	c, err := icmp.ListenPacket("ip4:icmp", listenAddr)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	// A raw socket sees every ICMP packet on the host, so replies are matched
+	// on ID, sequence number and source address.
+	id := os.Getpid() & 0xffff
+	seq := int(icmpRegionSeq.Add(1) & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   id,
+			Seq:  seq,
+			Data: []byte("PING"),
+		},
+	}
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(responseTimeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := c.WriteTo(msgBytes, &net.IPAddr{IP: dst}); err != nil {
+		return 0, err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(reply)
+		if err != nil {
+			return 0, fmt.Errorf("waiting for echo reply from %s: %w", dst, err)
+		}
+		elapsed := time.Since(start)
+
+		if ip, ok := peer.(*net.IPAddr); !ok || !ip.IP.Equal(dst) {
+			continue
+		}
+		msg, err := icmp.ParseMessage(1, reply[:n])
+		if err != nil {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if msg.Type == ipv4.ICMPTypeEchoReply && ok && echo.ID == id && echo.Seq == seq {
+			return elapsed, nil
+		}
+	}
+}
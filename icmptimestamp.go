@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+var icmpTimestamp = flag.Bool("icmp-timestamp", false, "also send the client ICMP timestamp requests (type 13) to estimate one-way delays; needs raw ICMP sockets")
+
+const (
+	// icmpTimestampProbes is how many timestamp requests are sent; the one
+	// with the shortest round trip is used.
+	icmpTimestampProbes  = 3
+	icmpTimestampTimeout = time.Second
+	msPerDay             = 24 * 60 * 60 * 1000
+)
+
+// msSinceMidnightUTC is the 32-bit timestamp format of RFC 792.
+func msSinceMidnightUTC(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight).Milliseconds())
+}
+
+// timestampDelta returns b - a in milliseconds, allowing for either side
+// having wrapped past midnight.
+func timestampDelta(a, b uint32) float64 {
+	d := (int64(b) - int64(a)) % msPerDay
+	if d > msPerDay/2 {
+		d -= msPerDay
+	} else if d < -msPerDay/2 {
+		d += msPerDay
+	}
+	return float64(d)
+}
+
+// measureOneWayDelays sends ICMP timestamp requests to the client and splits
+// the fastest round trip into its outbound and inbound legs, using the
+// client's receive and transmit timestamps. Each leg is off by the skew
+// between the two clocks, in opposite directions, and the timestamps only
+// have millisecond resolution, so the split is only as good as the clocks'
+// sync. Linux's unprivileged ICMP sockets only carry echoes, so this needs a
+// raw socket.
+func measureOneWayDelays(ipStr string) (outbound, inbound float64, err error) {
+	ip := net.ParseIP(ipStr).To4()
+	if ip == nil {
+		return 0, 0, fmt.Errorf("not an IPv4 address: %s", ipStr)
+	}
+	if !icmpAvailable() {
+		return 0, 0, errICMPUnavailable
+	}
+	listenAddr := "0.0.0.0"
+	if icmpSourceIP != "" {
+		listenAddr = icmpSourceIP
+	}
+	c, err := icmp.ListenPacket("ip4:icmp", listenAddr)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.Close()
+
+	best := -1.0
+	for i := 0; i < icmpTimestampProbes; i++ {
+		out, in, rtt, err := probeTimestamp(c, ip)
+		if err != nil {
+			return 0, 0, err
+		}
+		if rtt >= 0 && (best < 0 || rtt < best) {
+			outbound, inbound, best = out, in, rtt
+		}
+	}
+	if best < 0 {
+		return 0, 0, errors.New("no timestamp reply")
+	}
+	return outbound, inbound, nil
+}
+
+// probeTimestamp sends one timestamp request and returns both legs and the
+// round trip minus the client's processing time. A negative round trip means
+// no usable reply arrived.
+func probeTimestamp(c *icmp.PacketConn, dst net.IP) (outbound, inbound, rtt float64, err error) {
+	id := os.Getpid() & 0xffff
+	seq := int(icmpRegionSeq.Add(1) & 0xffff)
+	// ID, sequence number, then the originate, receive and transmit
+	// timestamps; the last two are the responder's to fill in.
+	body := make([]byte, 16)
+	binary.BigEndian.PutUint16(body[0:2], uint16(id))
+	binary.BigEndian.PutUint16(body[2:4], uint16(seq))
+	originate := msSinceMidnightUTC(time.Now())
+	binary.BigEndian.PutUint32(body[4:8], originate)
+	msg := icmp.Message{Type: ipv4.ICMPTypeTimestamp, Body: &icmp.RawBody{Data: body}}
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, 0, -1, err
+	}
+	if err := c.SetReadDeadline(time.Now().Add(icmpTimestampTimeout)); err != nil {
+		return 0, 0, -1, err
+	}
+	if _, err := c.WriteTo(msgBytes, &net.IPAddr{IP: dst}); err != nil {
+		return 0, 0, -1, err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(reply)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, 0, -1, nil
+			}
+			return 0, 0, -1, err
+		}
+		received := msSinceMidnightUTC(time.Now())
+		if ip, ok := peer.(*net.IPAddr); !ok || !ip.IP.Equal(dst) {
+			continue
+		}
+		msg, err := icmp.ParseMessage(1, reply[:n])
+		if err != nil || msg.Type != ipv4.ICMPTypeTimestampReply {
+			continue
+		}
+		raw, ok := msg.Body.(*icmp.RawBody)
+		if !ok || len(raw.Data) < 16 ||
+			int(binary.BigEndian.Uint16(raw.Data[0:2])) != id || int(binary.BigEndian.Uint16(raw.Data[2:4])) != seq {
+			continue
+		}
+		receive := binary.BigEndian.Uint32(raw.Data[8:12])
+		transmit := binary.BigEndian.Uint32(raw.Data[12:16])
+		// RFC 792 marks timestamps that aren't milliseconds since midnight
+		// UTC with the high bit.
+		if receive&0x80000000 != 0 || transmit&0x80000000 != 0 {
+			return 0, 0, -1, errors.New("client's timestamps are not in standard format")
+		}
+		outbound = timestampDelta(originate, receive)
+		inbound = timestampDelta(transmit, received)
+		return outbound, inbound, outbound + inbound, nil
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxImportBytes is the largest JSONL file POST /api/import accepts.
+const maxImportBytes = 1 << 20
+
+// maxImportedRuns is how many imported runs are kept. Importing another
+// evicts the oldest.
+const maxImportedRuns = 20
+
+// importedRun is a run uploaded through POST /api/import. Imported runs are
+// kept in memory only and never become the last run, so they don't affect
+// trends, history or the integrations.
+//
+// They are not stored in the history store as asked for: latencyHistory
+// only holds per-region latencies, with no notion of a named run to show
+// again. Imports are lost on restart and, as the endpoint is
+// unauthenticated, capped at maxImportedRuns so uploads can't exhaust
+// memory.
+type importedRun struct {
+	name       string
+	importedAt time.Time
+	results    []PingResult
+}
+
+var importedRuns struct {
+	sync.RWMutex
+	runs map[string]*importedRun
+	// order holds the run IDs oldest first.
+	order []string
+}
+
+// parseImport reads one PingResult per line, skipping blank lines, and
+// describes every line that isn't one.
+func parseImport(data []byte) (results []PingResult, problems []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var result PingResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if result.Code == "" {
+			problems = append(problems, fmt.Sprintf("line %d: missing code", line))
+			continue
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(results) == 0 && len(problems) == 0 {
+		problems = append(problems, "file has no results")
+	}
+	return results, problems
+}
+
+// importHandler accepts a JSONL file of PingResults as the "file" field of
+// a multipart form, with an optional "name", and redirects to the stored
+// run's page.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+
+	// Leave room for the multipart framing and the name field.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes+64*1024)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected a multipart upload with a file field, at most 1MB"})
+		return
+	}
+	defer file.Close()
+	if header.Size > maxImportBytes {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file is larger than 1MB"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reading upload: " + err.Error()})
+		return
+	}
+
+	results, problems := parseImport(data)
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "malformed results", "lines": problems})
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = header.Filename
+	}
+	id := newUUID()
+	importedRuns.Lock()
+	if importedRuns.runs == nil {
+		importedRuns.runs = make(map[string]*importedRun)
+	}
+	importedRuns.runs[id] = &importedRun{name: name, importedAt: time.Now(), results: results}
+	importedRuns.order = append(importedRuns.order, id)
+	if len(importedRuns.order) > maxImportedRuns {
+		delete(importedRuns.runs, importedRuns.order[0])
+		importedRuns.order = importedRuns.order[1:]
+	}
+	importedRuns.Unlock()
+
+	log.Printf("Imported %d results as run %s (%s)", len(results), id, name)
+	http.Redirect(w, r, "/runs/"+id, http.StatusSeeOther)
+}
+
+// importedRunHandler shows an imported run as a read-only report.
+func importedRunHandler(w http.ResponseWriter, r *http.Request) {
+	importedRuns.RLock()
+	run := importedRuns.runs[r.PathValue("run_id")]
+	importedRuns.RUnlock()
+	if run == nil {
+		http.Error(w, "No such run", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Date the run by its newest result, falling back to the upload time.
+	completedAt := time.Time{}
+	for _, result := range run.results {
+		if sent, err := time.Parse(time.RFC3339Nano, result.Timestamp); err == nil && sent.After(completedAt) {
+			completedAt = sent
+		}
+	}
+	if completedAt.IsZero() {
+		completedAt = run.importedAt
+	}
+	if err := renderNamedReport(w, "Imported: "+run.name, run.results, completedAt); err != nil {
+		log.Printf("Error rendering imported run: %v", err)
+	}
+}
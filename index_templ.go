@@ -15,7 +15,17 @@ type Region struct {
 	Code string
 }
 
-func page(regions []awsping.AWSRegion) templ.Component {
+type PageOptions struct {
+	ManualStart    bool   `json:"manualStart"`
+	AutoStartDelay int    `json:"autoStartDelay"`
+	ServerRegion   string `json:"serverRegion,omitempty"`
+	VPN            bool   `json:"vpn"`
+	SpeedTest      bool   `json:"speedTest"`
+	Baseline       bool   `json:"baseline"`
+	STUNServer     string `json:"stunServer,omitempty"`
+}
+
+func page(regions []awsping.AWSRegion, opts PageOptions) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -36,56 +46,174 @@ func page(regions []awsping.AWSRegion) templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<!doctype html><html><head><title>AWS Region Pinger</title><style>\n            body {\n                font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;\n                max-width: 1200px;\n                margin: 0 auto;\n                padding: 20px;\n                background: #f5f5f5;\n            }\n            .client-ping {\n                background: white;\n                padding: 15px;\n                margin-bottom: 20px;\n                border-radius: 4px;\n                box-shadow: 0 1px 3px rgba(0,0,0,0.1);\n            }\n            .client-ping .value {\n                font-family: monospace;\n                font-weight: bold;\n            }\n            table {\n                width: 100%;\n                border-collapse: collapse;\n                background: white;\n                box-shadow: 0 1px 3px rgba(0,0,0,0.1);\n                border-radius: 4px;\n            }\n            th, td {\n                padding: 12px;\n                text-align: left;\n                border-bottom: 1px solid #eee;\n            }\n            th {\n                background: #f8f9fa;\n                font-weight: 600;\n            }\n            .error {\n                color: #dc3545;\n            }\n            .latency {\n                font-family: monospace;\n                font-size: 14px;\n                min-width: 80px;\n            }\n        </style></head><body><h1>AWS Region Pinger</h1><div class=\"client-ping\">Your ping: <span class=\"value\" id=\"clientPing\">Measuring...</span></div><table id=\"results\"><thead><tr><th>Region</th><th>Code</th><th>Latency</th></tr></thead> <tbody>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<!doctype html><html><head><title>AWS Region Pinger</title><style>\n            body {\n                font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;\n                max-width: 1200px;\n                margin: 0 auto;\n                padding: 20px;\n                background: #f5f5f5;\n            }\n            .server-region {\n                margin-top: -10px;\n                color: #666;\n            }\n            .client-ping {\n                background: white;\n                padding: 15px;\n                margin-bottom: 20px;\n                border-radius: 4px;\n                box-shadow: 0 1px 3px rgba(0,0,0,0.1);\n            }\n            .client-ping .value {\n                font-family: monospace;\n                font-weight: bold;\n            }\n            td.sparkline svg {\n                display: block;\n            }\n            td.sparkline polyline {\n                fill: none;\n                stroke: #007bff;\n                stroke-width: 1.5;\n            }\n            .p2p input {\n                margin-left: 20px;\n            }\n            .client-ping .packet-loss {\n                margin-left: 20px;\n            }\n            .loss-none {\n                color: #28a745;\n            }\n            .loss-some {\n                color: #b8860b;\n            }\n            .loss-high {\n                color: #dc3545;\n            }\n            table {\n                width: 100%;\n                border-collapse: collapse;\n                background: white;\n                box-shadow: 0 1px 3px rgba(0,0,0,0.1);\n                border-radius: 4px;\n            }\n            th, td {\n                padding: 12px;\n                text-align: left;\n                border-bottom: 1px solid #eee;\n            }\n            th {\n                background: #f8f9fa;\n                font-weight: 600;\n            }\n            .controls {\n                margin-bottom: 20px;\n            }\n            .controls button, .controls .button {\n                padding: 8px 16px;\n                font-size: 14px;\n                cursor: pointer;\n            }\n            #runSummary {\n                margin-left: 10px;\n                color: #666;\n            }\n            .controls .button {\n                float: right;\n                color: #333;\n                text-decoration: none;\n                background: white;\n                border: 1px solid #ccc;\n                border-radius: 4px;\n            }\n            .error {\n                color: #dc3545;\n            }\n            .copy-curl {\n                visibility: hidden;\n                margin-left: 8px;\n                font-size: 11px;\n                cursor: pointer;\n            }\n            tr:hover .copy-curl {\n                visibility: visible;\n            }\n            .trend {\n                margin-left: 6px;\n                font-weight: bold;\n                cursor: help;\n            }\n            .trend-up {\n                color: #dc3545;\n            }\n            .trend-down {\n                color: #28a745;\n            }\n            .trend-stable {\n                color: #666;\n            }\n            .error-icon {\n                margin-right: 6px;\n                cursor: help;\n            }\n            .warning {\n                color: #b8860b;\n                margin-left: 6px;\n                cursor: help;\n            }\n            .badge {\n                display: inline-block;\n                padding: 1px 6px;\n                margin-left: 6px;\n                border-radius: 3px;\n                font-size: 11px;\n                background: #e9ecef;\n                cursor: help;\n            }\n            @keyframes pulse {\n                from { opacity: 0.4; }\n                to { opacity: 1; }\n            }\n            @keyframes spin {\n                to { transform: rotate(360deg); }\n            }\n            .status.pending {\n                animation: pulse 0.8s ease-in-out infinite alternate;\n                will-change: opacity;\n            }\n            .spinner {\n                display: inline-block;\n                width: 12px;\n                height: 12px;\n                border: 2px solid #ddd;\n                border-top-color: #666;\n                border-radius: 50%;\n                animation: spin 0.8s linear infinite;\n                vertical-align: middle;\n            }\n            .latency {\n                font-family: monospace;\n                font-size: 14px;\n                min-width: 80px;\n            }\n            .budget {\n                min-width: 160px;\n            }\n            .budget-bar {\n                position: relative;\n                height: 14px;\n                background: #eee;\n                border-radius: 7px;\n                overflow: hidden;\n            }\n            .budget-fill {\n                height: 100%;\n                background: #28a745;\n            }\n            .budget-bar.over .budget-fill {\n                background: #dc3545;\n            }\n            .budget-label {\n                font-family: monospace;\n                font-size: 12px;\n                color: #666;\n            }\n            .budget-bar.over + .budget-label {\n                color: #dc3545;\n            }\n            #error-panel {\n                max-height: 0;\n                opacity: 0;\n                overflow: hidden;\n                background: white;\n                border-left: 4px solid #dc3545;\n                border-radius: 4px;\n                box-shadow: 0 1px 3px rgba(0,0,0,0.1);\n                transform: translateY(-10px);\n                transition: max-height 0.3s ease, opacity 0.3s ease, transform 0.3s ease, margin-bottom 0.3s ease;\n            }\n            #error-panel.visible {\n                max-height: 300px;\n                opacity: 1;\n                margin-bottom: 20px;\n                transform: none;\n            }\n            #error-panel.empty {\n                border-left-color: #28a745;\n            }\n            .error-panel-header {\n                display: flex;\n                justify-content: space-between;\n                align-items: center;\n                padding: 10px 15px;\n                font-weight: 600;\n            }\n            .error-panel-header button {\n                font-size: 12px;\n                cursor: pointer;\n            }\n            #error-panel.collapsed #errorList {\n                display: none;\n            }\n            #errorList {\n                list-style: none;\n                margin: 0;\n                padding: 0 15px 10px;\n            }\n            #errorList li {\n                padding: 6px 0;\n                border-top: 1px solid #eee;\n                cursor: pointer;\n            }\n            #errorList li.none {\n                cursor: default;\n                color: #28a745;\n            }\n            #errorList .time {\n                font-family: monospace;\n                font-size: 12px;\n                color: #666;\n                margin-left: 6px;\n            }\n            #results tbody tr[data-code] {\n                cursor: pointer;\n            }\n            #results tbody tr.selected td {\n                background: #eef5ff;\n            }\n            tr.samples-row td {\n                background: #fafafa;\n                padding: 6px 12px 12px 40px;\n            }\n            table.samples {\n                width: auto;\n                box-shadow: none;\n                font-size: 13px;\n            }\n            table.samples th, table.samples td {\n                padding: 4px 12px;\n            }\n            .tls-details {\n                margin-top: 8px;\n            }\n            tr.vpn-row td {\n                color: #555;\n                background: #f8f9ff;\n            }\n            table.hide-vpn tr.vpn-row {\n                display: none;\n            }\n            @keyframes flash-improved {\n                from { background: #fff3a0; }\n                to { background: white; }\n            }\n            @keyframes flash-degraded {\n                from { background: #ffc0cb; }\n                to { background: white; }\n            }\n            td.flash-improved {\n                animation: flash-improved 3s ease-out;\n            }\n            td.flash-degraded {\n                animation: flash-degraded 3s ease-out;\n            }\n            table.changes-only > tbody > tr:not([data-changed]) {\n                display: none;\n            }\n            .vpn-delta.worse {\n                color: #dc3545;\n            }\n            .vpn-delta.better {\n                color: #28a745;\n            }\n            .baseline-delta.worse {\n                color: #dc3545;\n            }\n            .baseline-delta.better {\n                color: #28a745;\n            }\n            th.sortable {\n                cursor: pointer;\n            }\n            tr.group-header th {\n                background: #e9ecef;\n            }\n            .matrix {\n                margin-top: 30px;\n            }\n            .matrix textarea {\n                width: 100%;\n                box-sizing: border-box;\n                font-family: monospace;\n                margin-bottom: 8px;\n            }\n            .matrix td.cell {\n                font-family: monospace;\n                text-align: center;\n            }\n            .matrix td.good {\n                background: #d4edda;\n            }\n            .matrix td.fair {\n                background: #fff3cd;\n            }\n            .matrix td.poor {\n                background: #f8d7da;\n            }\n            .slo-ring {\n                display: inline-block;\n                width: 14px;\n                height: 14px;\n                margin-left: 6px;\n                vertical-align: middle;\n                border-radius: 50%;\n                background: conic-gradient(var(--slo-color) calc(var(--slo-pct) * 1%), #e9ecef 0);\n            }\n            .quality-badge {\n                display: inline-block;\n                padding: 4px 10px;\n                border-radius: 4px;\n                font-size: 14px;\n                font-weight: bold;\n                color: white;\n                cursor: help;\n            }\n            .quality-badge.excellent {\n                background: #28a745;\n            }\n            .quality-badge.good {\n                background: #17a2b8;\n            }\n            .quality-badge.fair {\n                background: #ffc107;\n                color: #333;\n            }\n            .quality-badge.poor {\n                background: #dc3545;\n            }\n            .health-dot {\n                display: inline-block;\n                width: 8px;\n                height: 8px;\n                margin-right: 6px;\n                border-radius: 50%;\n                background: #adb5bd;\n                cursor: help;\n            }\n            .health-dot.healthy {\n                background: #28a745;\n            }\n            .health-dot.degraded {\n                background: #ffc107;\n            }\n            .health-dot.disrupted {\n                background: #dc3545;\n            }\n            tr.highlight td {\n                background: #fff3cd;\n                transition: background 0.3s ease;\n            }\n        </style></head><body><h1>AWS Region Pinger</h1>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		for _, region := range regions {
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<tr data-code=\"")
+		if opts.ServerRegion != "" {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<p class=\"server-region\">Pinging from: ")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 			var templ_7745c5c3_Var2 string
-			templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(region.Code)
+			templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(opts.ServerRegion)
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 75, Col: 47}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 399, Col: 70}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><td>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</p>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div class=\"client-ping\">Your ping: <span class=\"value\" id=\"clientPing\">Measuring...</span> <span class=\"packet-loss\">Packet loss: <span class=\"value\" id=\"clientPacketLoss\">Measuring...</span></span> <span class=\"warning\" id=\"clientIPWarning\" hidden>⚠ datacenter IP</span></div><div class=\"client-ping p2p\">P2P Latency: <span class=\"value\" id=\"p2pLatency\">-</span> <input id=\"p2pRoom\" type=\"text\" placeholder=\"Room name\"> <button id=\"p2pCreate\" type=\"button\">Create</button> <button id=\"p2pJoin\" type=\"button\">Join</button> <span id=\"p2pStatus\"></span></div><div class=\"controls\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if opts.ManualStart {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<button id=\"startPing\" type=\"button\">Start Ping</button> ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<span id=\"startStatus\"></span> <span id=\"runSummary\"></span> <span class=\"warning\" id=\"locationWarning\" hidden></span> ")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if opts.VPN {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "<button id=\"toggleVPN\" type=\"button\">Hide VPN rows</button> ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "<button id=\"toggleChanges\" type=\"button\">Show changes only</button> <a class=\"button\" href=\"/api/report.html\" download=\"aws-ping-report.html\">Download report</a></div><div id=\"error-panel\"><div class=\"error-panel-header\"><span>Recent errors</span> <button id=\"errorPanelToggle\" type=\"button\">Hide</button></div><ul id=\"errorList\"></ul></div><table id=\"results\"><thead><tr><th>Region</th><th>Code</th><th>Server RTT <select id=\"latencyStat\" title=\"Which of each region&#39;s attempts to show\"><option value=\"min\">Min</option> <option value=\"p50\">P50</option> <option value=\"p95\">P95</option> <option value=\"p99\">P99</option> <option value=\"max\">Max</option></select></th><th title=\"Server RTT plus your ping to the server\">Est. Client RTT</th><th>Status</th><th>Budget</th><th title=\"Latency over the last 10 runs\">Trend</th><th title=\"From latency, jitter and packet loss\">Quality</th>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		if opts.SpeedTest {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "<th id=\"costHeader\" class=\"sortable\" title=\"Egress cost of 100 GB; click to sort by cost, then latency\">Cost/100GB</th>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			var templ_7745c5c3_Var3 string
-			templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(region.Name)
+		}
+		if opts.VPN {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "<th title=\"VPN latency minus direct latency\">VPN Δ</th>")
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 76, Col: 41}
+				return templ_7745c5c3_Err
 			}
-			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		}
+		if opts.Baseline {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "<th title=\"Server RTT minus the baseline run&#39;s\">vs Baseline</th>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</td><td>")
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "</tr></thead> <tbody>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		for i, region := range regions {
+			if i == consulGroupStart(regions) {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "<tr class=\"group-header\"><th colspan=\"")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var3 string
+				templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(consulHeaderColspan(opts))
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 468, Col: 67}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "\">Consul Services</th></tr>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, " <tr data-code=\"")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
 			var templ_7745c5c3_Var4 string
 			templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(region.Code)
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 77, Col: 41}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 471, Col: 47}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "</td><td class=\"latency\">Pending...</td></tr>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 16, "\"><td>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var5 string
+			templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(region.Name)
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 472, Col: 41}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 17, "</td><td>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var6 string
+			templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(region.Code)
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 473, Col: 41}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 18, "</td><td class=\"latency server-rtt\"><span class=\"spinner\"></span></td><td class=\"latency client-rtt\"><span class=\"spinner\"></span></td><td class=\"status pending\">Pinging...</td><td class=\"budget\"></td><td class=\"sparkline\"></td><td class=\"quality\"></td>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
+			if opts.SpeedTest {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 19, "<td class=\"cost\"></td>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			if opts.VPN {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 20, "<td class=\"latency vpn-delta\"></td>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			if opts.Baseline {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 21, "<td class=\"latency baseline-delta\"></td>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 22, "</tr>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 23, "</tbody></table><div class=\"matrix\"><h2>Reachability matrix</h2><textarea id=\"matrixAgents\" rows=\"3\" placeholder=\"One agent URL from --fleet-urls per line\"></textarea> <button id=\"matrixButton\" type=\"button\">Build matrix</button><div id=\"matrixResult\"></div></div><div class=\"matrix\"><h2>Service matrix</h2><button id=\"servicesButton\" type=\"button\">Test all services</button><div id=\"servicesResult\"></div></div><div class=\"matrix\"><h2>Import results</h2><form action=\"/api/import\" method=\"post\" enctype=\"multipart/form-data\"><input type=\"file\" name=\"file\" accept=\".jsonl,.json,application/x-ndjson\" required> <input type=\"text\" name=\"name\" placeholder=\"Run name (optional)\"> <button type=\"submit\">Import</button></form></div><script>\n            const clientPingElement = document.getElementById('clientPing');\n            const clientPacketLossElement = document.getElementById('clientPacketLoss');\n            const params = new URLSearchParams(window.location.search);\n            const pingURL = params.has('budget_ms') ? '/ping?budget_ms=' + encodeURIComponent(params.get('budget_ms')) : '/ping';\n            const pageOptions = ")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Var7, templ_7745c5c3_Err := templruntime.ScriptContentOutsideStringLiteral(opts)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `index.templ`, Line: 518, Col: 39}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ_7745c5c3_Var7)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</tbody></table><script>\n            const clientPingElement = document.getElementById('clientPing');\n            const evtSource = new EventSource('/ping');\n            \n            evtSource.onmessage = (event) => {\n                const result = JSON.parse(event.data);\n                \n                // Update client ping if available\n                if (result.clientPing !== undefined) {\n                    clientPingElement.textContent = result.clientPing.toFixed(2) + ' ms';\n                }\n                \n                // Find the row\n                const row = document.querySelector('tr[data-code=\"' + result.code + '\"]');\n                if (!row) return;\n                \n                // Update latency and status\n                const latencyCell = row.querySelector('.latency');\n                \n                if (result.error) {\n                    latencyCell.textContent = 'N/A';\n                } else {\n                    latencyCell.textContent = result.latency.toFixed(2) + ' ms';\n                }\n            };\n            \n            evtSource.onerror = () => {\n                console.error('EventSource failed');\n            };\n        </script></body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 24, ";\n            const startButton = document.getElementById('startPing');\n            const startStatus = document.getElementById('startStatus');\n            const runSummary = document.getElementById('runSummary');\n            const errorPanel = document.getElementById('error-panel');\n            const errorList = document.getElementById('errorList');\n            const errorPanelToggle = document.getElementById('errorPanelToggle');\n            const maxRecentErrors = 5;\n            const errorIcons = {\n                dns: ['🌐', 'DNS lookup failed'],\n                timeout: ['⏱', 'Timed out'],\n                connection_timeout: ['⏱', 'Connection timed out'],\n                response_timeout: ['⏱', 'Response timed out'],\n                connection_refused: ['⛔', 'Connection refused'],\n                tls: ['🔒', 'TLS handshake failed'],\n                http_error: ['⚠', 'HTTP error'],\n                unknown: ['❓', 'Unknown error'],\n            };\n            // regionCount is how many results make a complete run, which\n            // run_start replaces with the count the server will send.\n            let regionCount = document.querySelectorAll('#results tbody tr[data-code]').length;\n            let resultCount = 0;\n            let errorCount = 0;\n\n            errorPanelToggle.addEventListener('click', () => {\n                const collapsed = errorPanel.classList.toggle('collapsed');\n                errorPanelToggle.textContent = collapsed ? 'Show' : 'Hide';\n            });\n\n            function resetErrorPanel() {\n                resultCount = 0;\n                errorCount = 0;\n                errorList.innerHTML = '';\n                errorPanel.classList.remove('visible', 'empty');\n            }\n\n            function recordError(result, row) {\n                if (errorCount === 0) {\n                    errorList.innerHTML = '';\n                }\n                errorCount++;\n\n                const item = document.createElement('li');\n                const name = document.createElement('strong');\n                name.textContent = result.region;\n                const time = document.createElement('span');\n                time.className = 'time';\n                time.textContent = new Date(result.timestamp || Date.now()).toLocaleTimeString();\n                item.append(name, ': ' + result.error, time);\n                item.addEventListener('click', () => {\n                    row.scrollIntoView({ behavior: 'smooth', block: 'center' });\n                    row.classList.add('highlight');\n                    setTimeout(() => row.classList.remove('highlight'), 2000);\n                });\n\n                errorList.prepend(item);\n                while (errorList.children.length > maxRecentErrors) {\n                    errorList.lastChild.remove();\n                }\n                errorPanel.classList.add('visible');\n            }\n\n            function checkRunComplete() {\n                resultCount++;\n                if (resultCount < regionCount || errorCount > 0) return;\n                const item = document.createElement('li');\n                item.className = 'none';\n                item.textContent = 'No errors';\n                errorList.appendChild(item);\n                errorPanel.classList.add('visible', 'empty');\n            }\n\n            function handleResult(result) {\n                // Update client ping if available\n                if (result.clientPing === 0) {\n                    measureClientTiming();\n                } else if (result.clientPing !== undefined) {\n                    clientPingElement.textContent = result.clientPing.toFixed(2) + ' ms';\n                }\n                if (result.clientOutboundMs !== undefined || result.clientInboundMs !== undefined) {\n                    clientPingElement.title = 'ICMP timestamps: ~' + (result.clientOutboundMs || 0) + ' ms out, ~' +\n                        (result.clientInboundMs || 0) + ' ms in (each off by any clock skew between server and client)';\n                }\n                if (result.clientIPType === 'cloud' || result.clientIPType === 'vpn') {\n                    const ipWarning = document.getElementById('clientIPWarning');\n                    ipWarning.textContent = result.clientIPType === 'vpn' ? '⚠ VPN IP' : '⚠ datacenter IP';\n                    ipWarning.title = result.clientIPType === 'vpn'\n                        ? 'Your IP appears to be a VPN exit node; client latency may not reflect your end-user experience.'\n                        : 'Your IP appears to be a datacenter IP; client latency may not reflect your end-user experience.';\n                    ipWarning.hidden = false;\n                }\n                if (result.clientPacketLoss !== undefined) {\n                    clientPacketLossElement.textContent = result.clientPacketLoss.toFixed(0) + '%';\n                    clientPacketLossElement.className = 'value ' + (result.clientPacketLoss === 0 ? 'loss-none' : result.clientPacketLoss < 20 ? 'loss-some' : 'loss-high');\n                }\n                \n                // Find the row\n                const row = document.querySelector('tr[data-code=\"' + result.code + '\"][data-source=\"' + (result.sourceTag === 'vpn' ? 'vpn' : 'direct') + '\"]');\n                if (!row) return;\n\n                if (pageOptions.vpn && !result.error) {\n                    updateVPNDelta(result);\n                }\n                \n                if (result.timestamp) {\n                    row.dataset.timestamp = result.timestamp;\n                    const propagation = Date.now() - Date.parse(result.timestamp);\n                    console.debug('Result for ' + result.code + ' arrived ' + propagation + ' ms after it was sent');\n                }\n\n                row.pingSamples = { samples: result.samples || [], attempts: result.attempts || [] };\n                if (result.tlsVersion) {\n                    row.pingSamples.tls = [\n                        ['Version', result.tlsVersion],\n                        ['Cipher suite', result.tlsCipherSuite],\n                        ['ALPN protocol', result.tlsNegotiatedProto || 'none'],\n                        ['Certificate expires', result.tlsCertExpiry ? new Date(result.tlsCertExpiry).toLocaleDateString() : 'unknown'],\n                    ];\n                }\n                row.pingSamples.pathMTU = result.pathMTU;\n                if (result.s3EdgeId || result.s3RequestId || result.s3Server) {\n                    row.pingSamples.s3 = [\n                        ['Edge ID (x-amz-id-2)', result.s3EdgeId || 'none'],\n                        ['Request ID', result.s3RequestId || 'none'],\n                        ['Server', result.s3Server || 'none'],\n                    ];\n                }\n                if (row.dataset.expand === 'expanded') {\n                    renderSamples(row);\n                }\n\n                if (result.url) {\n                    addCopyCurlButton(row, result.url);\n                }\n                if (result.serviceHealth) {\n                    showServiceHealth(row, result);\n                }\n\n                // Update latency and status\n                const serverRTTCell = row.querySelector('.server-rtt');\n                const latencyCell = row.querySelector('.client-rtt');\n                const statusCell = row.querySelector('.status');\n                statusCell.classList.remove('pending');\n                \n                if (result.error) {\n                    serverRTTCell.textContent = 'N/A';\n                    latencyCell.textContent = 'N/A';\n                    statusCell.textContent = result.error;\n                    statusCell.classList.add('error');\n                    const [icon, label] = errorIcons[result.errorType] || errorIcons.unknown;\n                    const iconElement = document.createElement('span');\n                    iconElement.className = 'error-icon';\n                    iconElement.textContent = icon;\n                    iconElement.title = label;\n                    statusCell.prepend(iconElement);\n                    recordError(result, row);\n                } else {\n                    // Pings start at the server, so a client's round trip to the\n                    // region is roughly the server's plus the client-server leg.\n                    row.dataset.latency = result.latency;\n                    row.dataset.clientPing = result.clientPing || 0;\n                    showLatencyChange(row, serverRTTCell, result.latency);\n                    renderLatency(row);\n                    if (result.bdpBytes) {\n                        // Linux caps the receive window at tcp_rmem's max, of which\n                        // roughly half goes to data, so it needs to be twice the BDP.\n                        serverRTTCell.title = 'Bandwidth-delay product ' + (result.bdpBytes / 1024).toFixed(0) + ' KiB at ' +\n                            result.throughputMbps.toFixed(1) + ' Mbit/s; suggested net.ipv4.tcp_rmem = 4096 131072 ' + (2 * result.bdpBytes);\n                    }\n                    statusCell.textContent = 'OK';\n                    statusCell.classList.remove('error');\n                }\n\n                const qualityCell = row.querySelector('.quality');\n                if (result.qualityTier) {\n                    const badge = document.createElement('span');\n                    badge.className = 'quality-badge ' + result.qualityTier.toLowerCase();\n                    badge.textContent = result.qualityTier;\n                    badge.title = result.latency.toFixed(2) + ' ms latency, ' + result.jitterMs.toFixed(2) + ' ms jitter, ' +\n                        result.packetLossPct.toFixed(0) + '% loss';\n                    qualityCell.replaceChildren(badge);\n                } else {\n                    qualityCell.textContent = 'N/A';\n                }\n\n                if (pageOptions.baseline) {\n                    updateBaselineDelta(row, result);\n                }\n\n                if (pageOptions.speedTest) {\n                    const costCell = row.querySelector('.cost');\n                    if (result.estimatedCostPer100GbUsd) {\n                        row.dataset.cost = result.estimatedCostPer100GbUsd;\n                        costCell.textContent = '$' + result.estimatedCostPer100GbUsd.toFixed(2);\n                    } else {\n                        delete row.dataset.cost;\n                        costCell.textContent = 'N/A';\n                    }\n                }\n\n                if (result.servedFromCDN) {\n                    const badge = document.createElement('span');\n                    badge.className = 'badge';\n                    badge.textContent = 'CDN';\n                    badge.title = 'Served through CloudFront' + (result.cacheStatus ? ' (' + result.cacheStatus + ')' : '') +\n                        ': latency reflects the nearest edge location, not the S3 origin';\n                    statusCell.appendChild(badge);\n                }\n\n                if (result.deprecated) {\n                    const warning = document.createElement('span');\n                    warning.className = 'warning';\n                    warning.textContent = '⚠️ Possibly deprecated';\n                    warning.title = 'This region is missing from the regions AWS currently publishes';\n                    statusCell.appendChild(warning);\n                }\n\n                if (result.warning) {\n                    const warning = document.createElement('span');\n                    warning.className = 'warning';\n                    warning.textContent = '⚠️ ' + result.warning;\n                    statusCell.appendChild(warning);\n                }\n\n                if (result.geoDNSVariance) {\n                    const badge = document.createElement('span');\n                    badge.className = 'badge';\n                    badge.textContent = 'GeoDNS';\n                    badge.title = 'Resolvers returned different addresses:\\n' + result.dnsResolvers.map((answer) =>\n                        answer.resolver + ' → ' + (answer.ip || answer.error) +\n                        (answer.latencyMs !== undefined ? ' (' + answer.latencyMs.toFixed(2) + ' ms)' : '')).join('\\n');\n                    statusCell.appendChild(badge);\n                }\n\n                if (result.tlsResumptionActive) {\n                    const badge = document.createElement('span');\n                    badge.className = 'badge';\n                    badge.textContent = 'TLS resumed';\n                    badge.title = 'Resumed TLS handshake took ' + result.tlsResumedHandshakeMs.toFixed(2) +\n                        ' ms vs ' + result.tlsFirstHandshakeMs.toFixed(2) + ' ms for a full one';\n                    statusCell.appendChild(badge);\n                }\n\n                if (result.vpcEndpoint) {\n                    const badge = document.createElement('span');\n                    badge.className = 'badge';\n                    badge.textContent = '🔒';\n                    badge.title = 'VPC Endpoint detected';\n                    statusCell.appendChild(badge);\n                }\n\n                if (result.budgetPercent !== undefined) {\n                    const budgetCell = row.querySelector('.budget');\n                    const over = result.budgetPercent > 100;\n                    const remaining = result.budgetRemaining || 0;\n                    budgetCell.innerHTML = '<div class=\"budget-bar' + (over ? ' over' : '') + '\"><div class=\"budget-fill\"></div></div><div class=\"budget-label\"></div>';\n                    budgetCell.querySelector('.budget-fill').style.width = Math.min(result.budgetPercent, 100) + '%';\n                    budgetCell.querySelector('.budget-label').textContent = over\n                        ? result.budgetPercent.toFixed(0) + '% (' + (-remaining).toFixed(2) + ' ms over)'\n                        : result.budgetPercent.toFixed(0) + '% (' + remaining.toFixed(2) + ' ms left)';\n                }\n\n                if (result.spikeDetected) {\n                    const spike = document.createElement('span');\n                    spike.className = 'warning';\n                    spike.textContent = '⚡';\n                    spike.title = 'Latency spike: slowest attempt took ' + result.spikeLatencyMs.toFixed(2) + ' ms';\n                    statusCell.appendChild(spike);\n                }\n\n                if (result.trend) {\n                    const arrows = { up: '↑', down: '↓', stable: '→' };\n                    const trend = document.createElement('span');\n                    trend.className = 'trend trend-' + result.trend;\n                    trend.textContent = arrows[result.trend];\n                    trend.title = 'Since the previous run: ' + (result.trendDeltaMs > 0 ? '+' : '') + (result.trendDeltaMs || 0).toFixed(2) + ' ms';\n                    statusCell.appendChild(trend);\n                }\n\n                if (result.proxyDetected) {\n                    const warning = document.createElement('span');\n                    warning.className = 'warning';\n                    warning.textContent = '⚠ proxy';\n                    warning.title = 'A transparent HTTP proxy appears to sit between the server and S3';\n                    statusCell.appendChild(warning);\n                }\n\n                checkRunComplete();\n            }\n\n            function addCopyCurlButton(row, url) {\n                const codeCell = row.cells[1];\n                let button = codeCell.querySelector('.copy-curl');\n                if (!button) {\n                    button = document.createElement('button');\n                    button.type = 'button';\n                    button.className = 'copy-curl';\n                    button.textContent = 'Copy curl';\n                    button.addEventListener('click', (event) => {\n                        event.stopPropagation();\n                        const command = 'curl -o /dev/null -s -w \"%{time_total}\" -X HEAD \"' + button.dataset.url + '\"';\n                        navigator.clipboard.writeText(command).then(() => {\n                            button.textContent = 'Copied!';\n                            setTimeout(() => button.textContent = 'Copy curl', 1500);\n                        }, (err) => {\n                            console.error('Failed to copy curl command', err);\n                        });\n                    });\n                    codeCell.appendChild(button);\n                }\n                button.dataset.url = url;\n            }\n\n            // In VPN mode every region gets a second row for its VPN-sourced\n            // result, directly below the direct one.\n            document.querySelectorAll('#results tbody tr[data-code]').forEach((row) => {\n                row.dataset.source = 'direct';\n                if (!pageOptions.vpn) return;\n                const vpnRow = row.cloneNode(true);\n                vpnRow.dataset.source = 'vpn';\n                vpnRow.classList.add('vpn-row');\n                vpnRow.cells[0].textContent += ' (VPN)';\n                vpnRow.querySelector('.vpn-delta').textContent = '';\n                row.after(vpnRow);\n            });\n\n            // showServiceHealth puts a dot for the region's S3 status on the\n            // AWS Service Health Dashboard before its name.\n            function showServiceHealth(row, result) {\n                let dot = row.querySelector('.health-dot');\n                if (!dot) {\n                    dot = document.createElement('span');\n                    row.cells[0].prepend(dot);\n                }\n                dot.className = 'health-dot ' + result.serviceHealth;\n                dot.title = 'S3 status: ' + result.serviceHealth + (result.serviceHealthIncident ? ' - ' + result.serviceHealthIncident : '');\n            }\n\n            // latencyStat picks which of a region's successful attempts the\n            // latency cells show. Min matches the latency the server reports.\n            const latencyStatSelect = document.getElementById('latencyStat');\n            latencyStatSelect.value = localStorage.getItem('latencyStat') || 'min';\n            latencyStatSelect.addEventListener('change', () => {\n                localStorage.setItem('latencyStat', latencyStatSelect.value);\n                document.querySelectorAll('#results tbody tr[data-latency]').forEach(renderLatency);\n            });\n\n            function selectedLatency(row) {\n                const data = row.pingSamples;\n                const stat = latencyStatSelect.value;\n                if (stat === 'min' || !data) return Number(row.dataset.latency);\n                const sorted = data.samples.filter((ms, i) => !(data.attempts[i] || {}).error).sort((a, b) => a - b);\n                if (sorted.length === 0) return Number(row.dataset.latency);\n                if (stat === 'max') return sorted[sorted.length - 1];\n                // Nearest rank, as in /api/ping/aggregate.\n                const rank = Math.ceil(Number(stat.slice(1)) / 100 * sorted.length);\n                return sorted[Math.max(rank, 1) - 1];\n            }\n\n            // renderLatency fills a row's server and estimated client RTT\n            // cells from the selected statistic.\n            function renderLatency(row) {\n                const latency = selectedLatency(row);\n                row.querySelector('.server-rtt').textContent = latency.toFixed(2) + ' ms';\n                row.querySelector('.client-rtt').textContent = (latency + Number(row.dataset.clientPing || 0)).toFixed(2) + ' ms';\n            }\n\n            // previousLatencies holds each row's latency from the run before the\n            // current one, keyed by region code and source.\n            let previousLatencies = new Map();\n\n            function rememberLatencies() {\n                previousLatencies = new Map();\n                document.querySelectorAll('#results tbody tr[data-latency]').forEach(row => {\n                    previousLatencies.set(row.dataset.code + '/' + row.dataset.source, Number(row.dataset.latency));\n                    delete row.dataset.changed;\n                });\n            }\n\n            // showLatencyChange flashes the cell when the latency moved by more\n            // than 10% since the previous run: yellow if it improved, pink if\n            // it got worse.\n            function showLatencyChange(row, cell, latency) {\n                const previous = previousLatencies.get(row.dataset.code + '/' + row.dataset.source);\n                if (previous === undefined || Math.abs(latency - previous) <= previous * 0.1) {\n                    delete row.dataset.changed;\n                    return;\n                }\n                row.dataset.changed = latency < previous ? 'improved' : 'degraded';\n                cell.classList.remove('flash-improved', 'flash-degraded');\n                void cell.offsetWidth; // restart the animation\n                cell.classList.add('flash-' + row.dataset.changed);\n            }\n\n            const toggleChanges = document.getElementById('toggleChanges');\n            toggleChanges.addEventListener('click', () => {\n                const changesOnly = document.getElementById('results').classList.toggle('changes-only');\n                toggleChanges.textContent = changesOnly ? 'Show all rows' : 'Show changes only';\n            });\n\n            if (pageOptions.vpn) {\n                const toggleVPN = document.getElementById('toggleVPN');\n                toggleVPN.addEventListener('click', () => {\n                    const hidden = document.getElementById('results').classList.toggle('hide-vpn');\n                    toggleVPN.textContent = hidden ? 'Show VPN rows' : 'Hide VPN rows';\n                });\n            }\n\n            // updateVPNDelta shows VPN minus direct latency on the direct row\n            // once both results for a region are in.\n            function updateVPNDelta(result) {\n                const directRow = document.querySelector('tr[data-code=\"' + result.code + '\"][data-source=\"direct\"]');\n                directRow.dataset[result.sourceTag === 'vpn' ? 'vpnLatency' : 'directLatency'] = result.latency;\n                if (directRow.dataset.vpnLatency === undefined || directRow.dataset.directLatency === undefined) return;\n                const delta = Number(directRow.dataset.vpnLatency) - Number(directRow.dataset.directLatency);\n                const cell = directRow.querySelector('.vpn-delta');\n                cell.textContent = (delta > 0 ? '+' : '') + delta.toFixed(2) + ' ms';\n                cell.classList.toggle('worse', delta > 0);\n                cell.classList.toggle('better', delta < 0);\n            }\n\n            // updateBaselineDelta shows how far a result is from the baseline\n            // run. Results have no delta until a baseline has been taken.\n            function updateBaselineDelta(row, result) {\n                const cell = row.querySelector('.baseline-delta');\n                const delta = result.baselineDeltaMs;\n                cell.classList.remove('worse', 'better');\n                if (result.error || delta === undefined) {\n                    cell.textContent = '';\n                    return;\n                }\n                cell.textContent = (delta > 0 ? '+' : '') + delta.toFixed(2) + ' ms';\n                cell.classList.toggle('worse', delta > 0);\n                cell.classList.toggle('better', delta < 0);\n            }\n\n            // Clicking a row cycles it through selected, expanded (showing every\n            // attempt) and back to collapsed. The state lives on the row itself\n            // so it follows the row wherever it is moved.\n            document.querySelectorAll('#results tbody tr[data-code]').forEach((row) => {\n                row.addEventListener('click', () => {\n                    switch (row.dataset.expand) {\n                    case 'selected':\n                        row.dataset.expand = 'expanded';\n                        renderSamples(row);\n                        break;\n                    case 'expanded':\n                        delete row.dataset.expand;\n                        row.classList.remove('selected');\n                        if (row.samplesRow) row.samplesRow.remove();\n                        break;\n                    default:\n                        row.dataset.expand = 'selected';\n                        row.classList.add('selected');\n                    }\n                });\n            });\n\n            // detailsTable builds a collapsed name/value table for the\n            // attempts row.\n            function detailsTable(title, rows) {\n                const details = document.createElement('details');\n                details.className = 'tls-details';\n                const summary = document.createElement('summary');\n                summary.textContent = title;\n                details.appendChild(summary);\n                const table = document.createElement('table');\n                table.className = 'samples';\n                rows.forEach(([name, value]) => {\n                    const tr = table.insertRow();\n                    tr.insertCell().textContent = name;\n                    tr.insertCell().textContent = value;\n                });\n                details.appendChild(table);\n                return details;\n            }\n\n            function renderSamples(row) {\n                if (!row.samplesRow) {\n                    row.samplesRow = document.createElement('tr');\n                    row.samplesRow.className = 'samples-row';\n                    const cell = document.createElement('td');\n                    cell.colSpan = row.cells.length;\n                    row.samplesRow.appendChild(cell);\n                }\n                const cell = row.samplesRow.cells[0];\n                const data = row.pingSamples;\n                if (!data || data.samples.length === 0) {\n                    cell.textContent = 'No attempts recorded yet';\n                } else {\n                    const table = document.createElement('table');\n                    table.className = 'samples';\n                    table.innerHTML = '<thead><tr><th>Attempt</th><th>Duration</th><th>HTTP status</th><th>Error</th></tr></thead><tbody></tbody>';\n                    data.samples.forEach((ms, i) => {\n                        const attempt = data.attempts[i] || {};\n                        const tr = table.tBodies[0].insertRow();\n                        tr.insertCell().textContent = i + 1;\n                        tr.insertCell().textContent = ms.toFixed(2) + ' ms';\n                        tr.insertCell().textContent = attempt.status || '-';\n                        const errorCell = tr.insertCell();\n                        errorCell.textContent = attempt.error || '';\n                        errorCell.className = 'error';\n                    });\n                    cell.replaceChildren(table);\n                }\n                if (data && data.pathMTU) {\n                    const mtu = document.createElement('div');\n                    mtu.className = data.pathMTU < 1400 ? 'tls-details warning' : 'tls-details';\n                    mtu.textContent = 'Path MTU: ' + data.pathMTU + ' bytes' + (data.pathMTU < 1400 ? ' (below 1400, may fragment)' : '');\n                    cell.appendChild(mtu);\n                }\n                if (data && data.tls) {\n                    cell.appendChild(detailsTable('TLS details', data.tls));\n                }\n                if (data && data.s3) {\n                    cell.appendChild(detailsTable('S3 response', data.s3));\n                }\n                row.after(row.samplesRow);\n            }\n\n            function startPing() {\n                const evtSource = new EventSource(pingURL);\n\n                // Each (re)connection streams a fresh run.\n                evtSource.onopen = resetErrorPanel;\n\n                evtSource.onmessage = (event) => {\n                    const start = performance.now();\n                    const result = JSON.parse(event.data);\n                    handleResult(result);\n                    const elapsed = performance.now() - start;\n                    if (elapsed > 16) {\n                        console.warn('Slow SSE message handling for ' + result.code + ': ' + elapsed.toFixed(1) + ' ms');\n                    }\n                };\n\n                let showingStale = false;\n                evtSource.addEventListener('run_start', (event) => {\n                    const start = JSON.parse(event.data);\n                    streamRequestID = start.request_id;\n                    rememberLatencies();\n                    clientTimingMeasured = false;\n                    regionCount = start.region_count;\n                    // In VPN mode every region sends a direct and a VPN result.\n                    const regions = pageOptions.vpn && !start.replay && !start.stale ? start.region_count / 2 : start.region_count;\n                    runSummary.textContent = (start.replay ? 'Replaying ' : 'Pinging ') + regions + ' regions...';\n                    showingStale = !!start.stale;\n                    if (start.stale) {\n                        runSummary.textContent = 'Showing cached results from ' + start.cache_age_seconds + 's ago; reload for a fresh run';\n                    }\n                });\n\n                evtSource.addEventListener('run_queued', (event) => {\n                    const queued = JSON.parse(event.data);\n                    runSummary.textContent = 'Server busy, waiting for a run slot (position ' + queued.position + ')...';\n                });\n\n                evtSource.addEventListener('run_complete', (event) => {\n                    const summary = JSON.parse(event.data);\n                    if (showingStale) return;\n                    runSummary.textContent = 'First result in ' + summary.first_result_ms + 'ms, last result in ' +\n                        summary.last_result_ms + 'ms, total ' + summary.duration_ms + 'ms';\n                    if (summary.run_bytes_sent !== undefined || summary.run_bytes_received !== undefined) {\n                        runSummary.textContent += '. Transferred: ' + ((summary.run_bytes_sent || 0) / 1024).toFixed(1) + ' KB up / ' +\n                            ((summary.run_bytes_received || 0) / 1024).toFixed(1) + ' KB down';\n                    }\n                });\n                evtSource.addEventListener('run_complete', loadSLOs);\n                evtSource.addEventListener('run_complete', loadSparklines);\n\n                evtSource.addEventListener('server_location_changed', (event) => {\n                    const change = JSON.parse(event.data);\n                    const warning = document.getElementById('locationWarning');\n                    warning.textContent = '⚠ Server location may have changed';\n                    warning.title = 'Correlation with the baseline run is ' + change.correlation +\n                        '; fastest regions now ' + change.current_top.join(', ') + ' (were ' + change.baseline_top.join(', ') + ')';\n                    warning.hidden = false;\n                });\n\n                evtSource.addEventListener('client_timing_update', (event) => {\n                    const update = JSON.parse(event.data);\n                    clientPingElement.textContent = update.client_ping_ms.toFixed(2) + ' ms (HTTP)';\n                    document.querySelectorAll('#results tbody tr[data-latency]').forEach((row) => {\n                        row.dataset.clientPing = update.client_ping_ms;\n                        renderLatency(row);\n                    });\n                });\n\n                evtSource.onerror = () => {\n                    console.error('EventSource failed');\n                };\n            }\n\n            let streamRequestID = '';\n            let clientTimingMeasured = false;\n\n            // ICMP to the client failed, so time HTTP round trips to the\n            // server instead and let the stream correct clientPing.\n            async function measureClientTiming() {\n                if (clientTimingMeasured || !streamRequestID) return;\n                clientTimingMeasured = true;\n                let fastest = Infinity;\n                try {\n                    for (let i = 0; i < 3; i++) {\n                        performance.mark('client-timing-start');\n                        await fetch('/health', { cache: 'no-store' });\n                        performance.mark('client-timing-end');\n                        const measure = performance.measure('client-timing', 'client-timing-start', 'client-timing-end');\n                        fastest = Math.min(fastest, measure.duration);\n                    }\n                    performance.clearMarks('client-timing-start');\n                    performance.clearMarks('client-timing-end');\n                    performance.clearMeasures('client-timing');\n                    await fetch('/api/client-timing', {\n                        method: 'POST',\n                        headers: { 'Content-Type': 'application/json' },\n                        body: JSON.stringify({ request_id: streamRequestID, client_ping_ms: fastest }),\n                    });\n                } catch (err) {\n                    console.error('Failed to measure client timing', err);\n                }\n            }\n\n            // Orders the AWS regions by egress cost, then latency, so the\n            // cheapest fast region comes first. Regions without a price sort\n            // last; Consul targets keep their place at the end.\n            function sortByCost() {\n                const tbody = document.querySelector('#results tbody');\n                const rows = [...tbody.querySelectorAll('tr[data-code][data-source=\"direct\"]')];\n                const aws = rows.filter((row) => !row.dataset.code.startsWith('consul-'));\n                const value = (row, key) => row.dataset[key] === undefined ? Infinity : parseFloat(row.dataset[key]);\n                aws.sort((a, b) => (value(a, 'cost') - value(b, 'cost')) || (value(a, 'latency') - value(b, 'latency')));\n                const trailing = [...tbody.querySelectorAll('tr.group-header')].concat(rows.filter((row) => !aws.includes(row)));\n                aws.concat(trailing).forEach((row) => {\n                    tbody.appendChild(row);\n                    if (row.classList.contains('group-header')) return;\n                    const vpnRow = tbody.querySelector('tr[data-code=\"' + row.dataset.code + '\"][data-source=\"vpn\"]');\n                    if (vpnRow) tbody.appendChild(vpnRow);\n                    if (row.samplesRow && row.samplesRow.isConnected) tbody.appendChild(row.samplesRow);\n                });\n            }\n            if (pageOptions.speedTest) {\n                document.getElementById('costHeader').addEventListener('click', sortByCost);\n            }\n\n            // Peer-to-peer latency: one tab creates a room and the other joins\n            // it. The server only passes the SDP offer and answer between\n            // them; the round trip is timed over a data channel between the\n            // two browsers.\n            const p2pLatency = document.getElementById('p2pLatency');\n            const p2pStatus = document.getElementById('p2pStatus');\n            const p2pRoom = document.getElementById('p2pRoom');\n\n            function newPeerConnection() {\n                const iceServers = pageOptions.stunServer ? [{ urls: pageOptions.stunServer }] : [];\n                return new RTCPeerConnection({ iceServers });\n            }\n\n            // Candidates are sent inside the SDP rather than trickled, so wait\n            // until gathering has finished.\n            function gatheringComplete(pc) {\n                if (pc.iceGatheringState === 'complete') return Promise.resolve();\n                return new Promise((resolve) => {\n                    pc.addEventListener('icegatheringstatechange', () => {\n                        if (pc.iceGatheringState === 'complete') resolve();\n                    });\n                });\n            }\n\n            async function postSDP(path, sdp) {\n                const response = await fetch(path, {\n                    method: 'POST',\n                    headers: { 'Content-Type': 'application/json' },\n                    body: JSON.stringify({ room: p2pRoom.value, sdp }),\n                });\n                if (!response.ok) throw new Error((await response.json()).error);\n            }\n\n            async function fetchSDP(path) {\n                const response = await fetch(path + '?room=' + encodeURIComponent(p2pRoom.value));\n                if (response.status === 404) return null;\n                if (!response.ok) throw new Error((await response.json()).error);\n                return (await response.json()).sdp;\n            }\n\n            function pingPeer(channel) {\n                channel.onmessage = (event) => {\n                    const rtt = performance.now() - parseFloat(event.data);\n                    p2pLatency.textContent = rtt.toFixed(2) + ' ms';\n                };\n                const timer = setInterval(() => {\n                    if (channel.readyState !== 'open') {\n                        clearInterval(timer);\n                        p2pStatus.textContent = 'Disconnected';\n                        return;\n                    }\n                    channel.send(String(performance.now()));\n                }, 1000);\n            }\n\n            document.getElementById('p2pCreate').addEventListener('click', async () => {\n                if (!p2pRoom.value) return;\n                try {\n                    const pc = newPeerConnection();\n                    const channel = pc.createDataChannel('ping');\n                    channel.onopen = () => {\n                        p2pStatus.textContent = 'Connected';\n                        pingPeer(channel);\n                    };\n                    await pc.setLocalDescription(await pc.createOffer());\n                    await gatheringComplete(pc);\n                    await postSDP('/rtc/offer', pc.localDescription.sdp);\n                    p2pStatus.textContent = 'Waiting for the other tab to join...';\n                    let answer = null;\n                    while (answer === null) {\n                        await new Promise((resolve) => setTimeout(resolve, 1000));\n                        answer = await fetchSDP('/rtc/answer');\n                    }\n                    await pc.setRemoteDescription({ type: 'answer', sdp: answer });\n                } catch (err) {\n                    p2pStatus.textContent = 'Error: ' + err.message;\n                }\n            });\n\n            document.getElementById('p2pJoin').addEventListener('click', async () => {\n                if (!p2pRoom.value) return;\n                try {\n                    const offer = await fetchSDP('/rtc/offer');\n                    if (offer === null) {\n                        p2pStatus.textContent = 'No such room';\n                        return;\n                    }\n                    const pc = newPeerConnection();\n                    // The joining side echoes every timestamp straight back.\n                    pc.ondatachannel = (event) => {\n                        event.channel.onmessage = (message) => event.channel.send(message.data);\n                        p2pStatus.textContent = 'Connected';\n                        p2pLatency.textContent = 'see the other tab';\n                    };\n                    await pc.setRemoteDescription({ type: 'offer', sdp: offer });\n                    await pc.setLocalDescription(await pc.createAnswer());\n                    await gatheringComplete(pc);\n                    await postSDP('/rtc/answer', pc.localDescription.sdp);\n                    p2pStatus.textContent = 'Connecting...';\n                } catch (err) {\n                    p2pStatus.textContent = 'Error: ' + err.message;\n                }\n            });\n\n            // Draws the last latencies as a 100x20 SVG line, scaled to the\n            // row's own range. Failed runs (null) break the line.\n            function renderSparkline(cell, samples) {\n                const values = samples.filter((v) => v !== null);\n                if (values.length < 2) {\n                    cell.textContent = '';\n                    return;\n                }\n                const min = Math.min(...values);\n                const range = (Math.max(...values) - min) || 1;\n                const step = 100 / (samples.length - 1);\n                const svgNS = 'http://www.w3.org/2000/svg';\n                const svg = document.createElementNS(svgNS, 'svg');\n                svg.setAttribute('width', '100');\n                svg.setAttribute('height', '20');\n                let points = [];\n                const flush = () => {\n                    if (points.length > 1) {\n                        const line = document.createElementNS(svgNS, 'polyline');\n                        line.setAttribute('points', points.join(' '));\n                        svg.appendChild(line);\n                    }\n                    points = [];\n                };\n                samples.forEach((v, i) => {\n                    if (v === null) {\n                        flush();\n                        return;\n                    }\n                    points.push((i * step).toFixed(1) + ',' + (19 - (v - min) / range * 18).toFixed(1));\n                });\n                flush();\n                svg.setAttribute('aria-label', values.map((v) => v.toFixed(0) + ' ms').join(', '));\n                cell.replaceChildren(svg);\n            }\n\n            function loadSparklines() {\n                document.querySelectorAll('#results tbody tr[data-code][data-source=\"direct\"]').forEach(async (row) => {\n                    try {\n                        const response = await fetch('/api/history/sparkline?n=10&region=' + encodeURIComponent(row.dataset.code));\n                        if (!response.ok) return;\n                        renderSparkline(row.querySelector('.sparkline'), await response.json());\n                    } catch (err) {\n                        console.error('Failed to load sparkline for ' + row.dataset.code, err);\n                    }\n                });\n            }\n            loadSparklines();\n\n            async function loadSLOs() {\n                let slos;\n                try {\n                    const response = await fetch('/api/slo');\n                    if (!response.ok) return;\n                    slos = await response.json();\n                } catch (err) {\n                    console.error('Failed to load SLO compliance', err);\n                    return;\n                }\n                slos.forEach((slo) => {\n                    const row = document.querySelector('tr[data-code=\"' + slo.region + '\"][data-source=\"direct\"]');\n                    if (!row || slo.measurements_total === 0) return;\n                    let ring = row.querySelector('.slo-ring');\n                    if (!ring) {\n                        ring = document.createElement('span');\n                        ring.className = 'slo-ring';\n                        row.cells[0].appendChild(ring);\n                    }\n                    ring.style.setProperty('--slo-pct', slo.compliance_pct);\n                    ring.style.setProperty('--slo-color', slo.compliance_pct >= 99 ? '#28a745' : slo.compliance_pct >= 95 ? '#ffc107' : '#dc3545');\n                    ring.title = 'SLO < ' + slo.threshold_ms + ' ms over ' + slo.window_days + ' days: ' +\n                        slo.compliance_pct + '% (' + slo.measurements_passing + '/' + slo.measurements_total + ')';\n                });\n            }\n            loadSLOs();\n\n            const matrixAgents = document.getElementById('matrixAgents');\n            const matrixButton = document.getElementById('matrixButton');\n            const matrixResult = document.getElementById('matrixResult');\n\n            matrixButton.addEventListener('click', async () => {\n                const urls = matrixAgents.value.split('\\n').map((url) => url.trim()).filter((url) => url !== '');\n                if (urls.length === 0) return;\n                matrixButton.disabled = true;\n                matrixResult.textContent = 'Querying agents...';\n                try {\n                    const response = await fetch('/api/matrix', {\n                        method: 'POST',\n                        headers: { 'Content-Type': 'application/json' },\n                        body: JSON.stringify(urls),\n                    });\n                    const data = await response.json();\n                    if (!response.ok) throw new Error(data.error || response.statusText);\n                    renderMatrix(data);\n                } catch (err) {\n                    matrixResult.textContent = 'Error: ' + err.message;\n                    matrixResult.className = 'error';\n                } finally {\n                    matrixButton.disabled = false;\n                }\n            });\n\n            function renderMatrix(data) {\n                const label = (agent) => agent.region ? agent.region + ' (' + agent.url + ')' : agent.url;\n                const table = document.createElement('table');\n                const head = table.createTHead().insertRow();\n                head.appendChild(document.createElement('th'));\n                data.agents.forEach((agent) => {\n                    const th = document.createElement('th');\n                    th.textContent = label(agent);\n                    head.appendChild(th);\n                });\n                const body = table.createTBody();\n                data.agents.forEach((agent, i) => {\n                    const tr = body.insertRow();\n                    const th = document.createElement('th');\n                    th.textContent = label(agent);\n                    if (agent.error) {\n                        th.title = agent.error;\n                        th.classList.add('error');\n                    }\n                    tr.appendChild(th);\n                    data.matrix[i].forEach((latency) => {\n                        const td = tr.insertCell();\n                        td.classList.add('cell');\n                        if (latency === null) {\n                            td.textContent = 'N/A';\n                            return;\n                        }\n                        td.textContent = latency.toFixed(2) + ' ms';\n                        td.classList.add(latency < 100 ? 'good' : latency < 200 ? 'fair' : 'poor');\n                    });\n                });\n                matrixResult.className = '';\n                matrixResult.replaceChildren(table);\n            }\n\n            const servicesButton = document.getElementById('servicesButton');\n            const servicesResult = document.getElementById('servicesResult');\n\n            servicesButton.addEventListener('click', async () => {\n                servicesButton.disabled = true;\n                servicesResult.className = '';\n                servicesResult.textContent = 'Pinging EC2, S3, RDS and Lambda in every region...';\n                try {\n                    const response = await fetch('/api/services');\n                    if (!response.ok) throw new Error(response.statusText);\n                    renderServiceMatrix(await response.json());\n                } catch (err) {\n                    servicesResult.textContent = 'Error: ' + err.message;\n                    servicesResult.className = 'error';\n                } finally {\n                    servicesButton.disabled = false;\n                }\n            });\n\n            function renderServiceMatrix(matrix) {\n                const services = [...new Set(Object.values(matrix).flatMap((row) => Object.keys(row)))].sort();\n                const codes = Object.keys(matrix).sort((a, b) =>\n                    Math.min(...Object.values(matrix[a])) - Math.min(...Object.values(matrix[b])));\n\n                const table = document.createElement('table');\n                const head = table.createTHead().insertRow();\n                ['Region', ...services].forEach((name) => {\n                    const th = document.createElement('th');\n                    th.textContent = name;\n                    head.appendChild(th);\n                });\n                const body = table.createTBody();\n                codes.forEach((code) => {\n                    const tr = body.insertRow();\n                    tr.insertCell().textContent = code;\n                    services.forEach((service) => {\n                        const td = tr.insertCell();\n                        td.classList.add('cell');\n                        const latency = matrix[code][service];\n                        if (latency === undefined) {\n                            td.textContent = 'N/A';\n                            return;\n                        }\n                        td.textContent = latency.toFixed(0) + ' ms';\n                        td.classList.add(latency < 100 ? 'good' : latency < 200 ? 'fair' : 'poor');\n                    });\n                });\n                servicesResult.replaceChildren(table);\n            }\n\n            if (pageOptions.manualStart) {\n                startButton.addEventListener('click', () => {\n                    startButton.disabled = true;\n                    startPing();\n                });\n            } else if (pageOptions.autoStartDelay > 0) {\n                let remaining = pageOptions.autoStartDelay;\n                startStatus.textContent = 'Starting in ' + remaining + 's...';\n                const countdown = setInterval(() => {\n                    remaining--;\n                    if (remaining > 0) {\n                        startStatus.textContent = 'Starting in ' + remaining + 's...';\n                        return;\n                    }\n                    clearInterval(countdown);\n                    startStatus.textContent = '';\n                    startPing();\n                }, 1000);\n            } else {\n                startPing();\n            }\n        </script></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	verifyAWSIPs    = flag.Bool("verify-aws-ips", false, "check that each region's endpoint resolved to an address in AWS's published S3 ranges")
+	awsIPRangesFile = flag.String("aws-ip-ranges-file", "", "local copy of ip-ranges.json to use instead of downloading it")
+)
+
+// ipRangesURL is AWS's published list of IP prefixes, tagged by region. It is
+// the only public, unauthenticated list of the regions AWS currently serves.
+const ipRangesURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+// ipRanges is the part of ip-ranges.json this server uses.
+type ipRanges struct {
+	Prefixes []struct {
+		IPPrefix string `json:"ip_prefix"`
+		Region   string `json:"region"`
+		Service  string `json:"service"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+}
+
+// fetchIPRanges reads --aws-ip-ranges-file, or downloads ip-ranges.json when
+// it is unset.
+func fetchIPRanges() (*ipRanges, error) {
+	var ranges ipRanges
+	if *awsIPRangesFile != "" {
+		data, err := os.ReadFile(*awsIPRangesFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &ranges); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", *awsIPRangesFile, err)
+		}
+		return &ranges, nil
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Get(ipRangesURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ip-ranges.json returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ranges); err != nil {
+		return nil, fmt.Errorf("decoding ip-ranges.json: %w", err)
+	}
+	return &ranges, nil
+}
+
+// s3Prefixes caches the published S3 ranges once a run has loaded them.
+var s3Prefixes struct {
+	sync.Mutex
+	nets []*net.IPNet
+}
+
+// loadS3Prefixes returns the published S3 ranges, fetching them on the first
+// call. A failed fetch is retried by the next run.
+func loadS3Prefixes() ([]*net.IPNet, error) {
+	s3Prefixes.Lock()
+	defer s3Prefixes.Unlock()
+	if s3Prefixes.nets != nil {
+		return s3Prefixes.nets, nil
+	}
+
+	ranges, err := fetchIPRanges()
+	if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	for _, prefix := range ranges.Prefixes {
+		if prefix.Service == "S3" {
+			cidrs = append(cidrs, prefix.IPPrefix)
+		}
+	}
+	for _, prefix := range ranges.IPv6Prefixes {
+		if prefix.Service == "S3" {
+			cidrs = append(cidrs, prefix.IPv6Prefix)
+		}
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Skipping invalid S3 prefix %q: %v", cidr, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	s3Prefixes.nets = nets
+	return nets, nil
+}
+
+// inPrefixes reports whether ip falls in any of nets.
+func inPrefixes(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
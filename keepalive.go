@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var (
+	keepAliveIntervalMs = flag.Int("keepalive-interval-ms", 30000, "TCP keep-alive probe interval in milliseconds for ping connections")
+	keepAliveDisable    = flag.Bool("keepalive-disable", false, "turn TCP keep-alive probes off for ping connections")
+)
+
+// keepAliveBenchmarkRuns is how many consecutive runs
+// /api/keepalive-benchmark makes with each setting.
+const keepAliveBenchmarkRuns = 3
+
+// tcpKeepAlive is the net.Dialer.KeepAlive period ping connections use.
+func tcpKeepAlive() time.Duration {
+	if *keepAliveDisable {
+		return -1
+	}
+	return time.Duration(*keepAliveIntervalMs) * time.Millisecond
+}
+
+// KeepAliveRun is one run of a keep-alive benchmark: the fastest ping with
+// and without keep-alive probes, or nil where every attempt failed.
+type KeepAliveRun struct {
+	KeepAliveMs   *float64 `json:"keepalive_ms"`
+	NoKeepAliveMs *float64 `json:"no_keepalive_ms"`
+}
+
+// KeepAliveBenchmark is the response of GET /api/keepalive-benchmark.
+type KeepAliveBenchmark struct {
+	Region string `json:"region"`
+	// IntervalMs is the keep-alive interval the "with" runs use: the
+	// configured one, or the Go default of 15s under --keepalive-disable.
+	IntervalMs int64          `json:"interval_ms"`
+	Runs       []KeepAliveRun `json:"runs"`
+	// MeanKeepAliveMs and MeanNoKeepAliveMs average the runs that succeeded.
+	MeanKeepAliveMs   *float64 `json:"mean_keepalive_ms"`
+	MeanNoKeepAliveMs *float64 `json:"mean_no_keepalive_ms"`
+}
+
+// fastestPing returns the fastest of pingAttempts pings, in milliseconds.
+func fastestPing(ctx context.Context, client *http.Client, region awsping.AWSRegion) *float64 {
+	var fastest time.Duration
+	for i := 0; i < pingAttempts; i++ {
+		sample, err := pingRegion(ctx, client, region, "", nil)
+		if err != nil {
+			continue
+		}
+		if fastest == 0 || sample.latency < fastest {
+			fastest = sample.latency
+		}
+	}
+	if fastest == 0 {
+		return nil
+	}
+	ms := float64(fastest) / float64(time.Millisecond)
+	return &ms
+}
+
+func meanOf(values []*float64) *float64 {
+	var sum float64
+	var n int
+	for _, v := range values {
+		if v != nil {
+			sum += *v
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	mean := sum / float64(n)
+	return &mean
+}
+
+// keepAliveBenchmarkHandler pings one region in consecutive runs, each
+// with a client that sends TCP keep-alive probes and one that doesn't.
+// Every benchmark starts from fresh clients, so the first run includes the
+// handshakes and later ones show what reuse leaves.
+func keepAliveBenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("region")
+	if code == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "region is required"})
+		return
+	}
+	var region awsping.AWSRegion
+	found := false
+	for _, candidate := range getRegions() {
+		if candidate.Code == code && !strings.HasPrefix(code, consulCodePrefix) {
+			region, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown region " + code})
+		return
+	}
+
+	interval := time.Duration(*keepAliveIntervalMs) * time.Millisecond
+	if *keepAliveDisable {
+		interval = 15 * time.Second
+	}
+	withKeepAlive := newPingClientWithKeepAlive(*bindIP, interval)
+	withoutKeepAlive := newPingClientWithKeepAlive(*bindIP, -1)
+	defer withKeepAlive.CloseIdleConnections()
+	defer withoutKeepAlive.CloseIdleConnections()
+
+	benchmark := KeepAliveBenchmark{Region: code, IntervalMs: interval.Milliseconds()}
+	var with, without []*float64
+	for i := 0; i < keepAliveBenchmarkRuns; i++ {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(float64(responseTimeout()*pingAttempts*2)*1.1))
+		run := KeepAliveRun{
+			KeepAliveMs:   fastestPing(ctx, withKeepAlive, region),
+			NoKeepAliveMs: fastestPing(ctx, withoutKeepAlive, region),
+		}
+		cancel()
+		if r.Context().Err() != nil {
+			return
+		}
+		benchmark.Runs = append(benchmark.Runs, run)
+		with = append(with, run.KeepAliveMs)
+		without = append(without, run.NoKeepAliveMs)
+	}
+	benchmark.MeanKeepAliveMs = meanOf(with)
+	benchmark.MeanNoKeepAliveMs = meanOf(without)
+	writeJSON(w, http.StatusOK, benchmark)
+}
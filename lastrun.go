@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// lastRun holds the results of the most recently completed ping run.
+var lastRun struct {
+	sync.RWMutex
+	results     []PingResult
+	completedAt time.Time
+}
+
+func setLastRun(results []PingResult) {
+	lastRun.Lock()
+	defer lastRun.Unlock()
+	lastRun.results = results
+	lastRun.completedAt = time.Now()
+}
+
+// getLastRun returns the last completed run, or ok == false if no run has
+// completed since the server started.
+func getLastRun() (results []PingResult, completedAt time.Time, ok bool) {
+	lastRun.RLock()
+	defer lastRun.RUnlock()
+	if lastRun.results == nil {
+		return nil, time.Time{}, false
+	}
+	return lastRun.results, lastRun.completedAt, true
+}
+
+// trendStableFraction is the relative change below which a region's latency
+// trend is reported as stable.
+const trendStableFraction = 0.05
+
+// previousLatencies maps region codes to their successful latency in the last
+// completed run.
+func previousLatencies() map[string]float64 {
+	results, _, ok := getLastRun()
+	if !ok {
+		return nil
+	}
+	latencies := make(map[string]float64, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			latencies[result.Code] = result.Latency
+		}
+	}
+	return latencies
+}
+
+// setTrend compares result with the region's previous latency and records
+// whether it got worse ("up"), better ("down") or stayed within 5%.
+func setTrend(result *PingResult, previous map[string]float64) {
+	before, ok := previous[result.Code]
+	if !ok || result.Error != "" || before == 0 {
+		return
+	}
+	result.TrendDeltaMs = result.Latency - before
+	switch {
+	case math.Abs(result.TrendDeltaMs) < before*trendStableFraction:
+		result.Trend = "stable"
+	case result.TrendDeltaMs > 0:
+		result.Trend = "up"
+	default:
+		result.Trend = "down"
+	}
+}
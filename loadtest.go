@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var (
+	loadTestIPs    = flag.String("load-test-ips", "", "comma-separated local source IPs that /api/load-test rotates through")
+	loadTestCycles = flag.Int("load-test-cycles", 5, "number of round-robin cycles run by /api/load-test")
+)
+
+// loadTestSources holds the validated --load-test-ips.
+var loadTestSources []string
+
+// loadTestClients holds one ping client per source IP, built on first use.
+var loadTestClients struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}
+
+func loadTestClient(sourceIP string) *http.Client {
+	loadTestClients.Lock()
+	defer loadTestClients.Unlock()
+	if loadTestClients.clients == nil {
+		loadTestClients.clients = make(map[string]*http.Client)
+	}
+	client, ok := loadTestClients.clients[sourceIP]
+	if !ok {
+		client = newPingClient(sourceIP)
+		loadTestClients.clients[sourceIP] = client
+	}
+	return client
+}
+
+// parseLoadTestIPs checks that every --load-test-ips address is local.
+func parseLoadTestIPs(value string) ([]string, error) {
+	var ips []string
+	for _, ip := range strings.Split(value, ",") {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		if err := validateBindIP(ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// SourceIPStats summarises the pings sent from one source IP.
+type SourceIPStats struct {
+	Pings   int          `json:"pings"`
+	Errors  int          `json:"errors"`
+	MinMs   float64      `json:"min_ms"`
+	MeanMs  float64      `json:"mean_ms"`
+	MaxMs   float64      `json:"max_ms"`
+	Results []PingResult `json:"results"`
+}
+
+type LoadTestReport struct {
+	Cycles  int                       `json:"cycles"`
+	Sources map[string]*SourceIPStats `json:"sources"`
+}
+
+// runLoadTest pings every region once per cycle. Region i is sent from
+// source IP (i + cycle) mod len(sources), so over the cycles each region is
+// reached from every source and a degraded egress path stands out in its
+// source's statistics.
+func runLoadTest(ctx context.Context, regions []awsping.AWSRegion, sources []string, cycles int) LoadTestReport {
+	report := LoadTestReport{Cycles: cycles, Sources: make(map[string]*SourceIPStats, len(sources))}
+	for _, ip := range sources {
+		report.Sources[ip] = &SourceIPStats{Results: []PingResult{}}
+	}
+
+	var mu sync.Mutex
+	for cycle := 0; cycle < cycles && ctx.Err() == nil; cycle++ {
+		var wg sync.WaitGroup
+		for i, region := range regions {
+			sourceIP := sources[(i+cycle)%len(sources)]
+			wg.Add(1)
+			go func(region awsping.AWSRegion) {
+				defer wg.Done()
+				result := PingResult{
+					Region:    region.Name,
+					Code:      region.Code,
+					SourceIP:  sourceIP,
+					ErrorType: errorTypeNone,
+					Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+				}
+				sample, err := pingRegion(ctx, loadTestClient(sourceIP), region, "", nil)
+				if err != nil {
+					result.Error = err.Error()
+					result.ErrorType = classifyError(err)
+				} else {
+					result.Latency = float64(sample.latency) / float64(time.Millisecond)
+				}
+				mu.Lock()
+				report.Sources[sourceIP].Results = append(report.Sources[sourceIP].Results, result)
+				mu.Unlock()
+			}(region)
+		}
+		wg.Wait()
+	}
+
+	for ip, stats := range report.Sources {
+		var sum float64
+		stats.Pings = len(stats.Results)
+		for _, result := range stats.Results {
+			if result.Error != "" {
+				stats.Errors++
+				continue
+			}
+			sum += result.Latency
+			if stats.MinMs == 0 || result.Latency < stats.MinMs {
+				stats.MinMs = result.Latency
+			}
+			stats.MaxMs = max(stats.MaxMs, result.Latency)
+		}
+		if ok := stats.Pings - stats.Errors; ok > 0 {
+			stats.MeanMs = math.Round(sum/float64(ok)*100) / 100
+		}
+		log.Printf("Load test from %s: %d pings, %d errors, mean %.2fms", ip, stats.Pings, stats.Errors, stats.MeanMs)
+	}
+	return report
+}
+
+func loadTestHandler(w http.ResponseWriter, r *http.Request) {
+	if len(loadTestSources) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no --load-test-ips configured"})
+		return
+	}
+	var regions []awsping.AWSRegion
+	for _, region := range getRegions() {
+		if !strings.HasPrefix(region.Code, consulCodePrefix) {
+			regions = append(regions, region)
+		}
+	}
+	if !acquireRunSlot(r.Context(), func(int) {}) {
+		return
+	}
+	defer releaseRunSlot()
+	writeJSON(w, http.StatusOK, runLoadTest(r.Context(), regions, loadTestSources, *loadTestCycles))
+}
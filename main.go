@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,105 +29,990 @@ import (
 	"golang.org/x/net/ipv4"
 )
 
+var (
+	probeProxy        = flag.Bool("probe-proxy", false, "send two follow-up GET probes after each ping to detect transparent HTTP proxies; with no known S3 object to check against, the probes' body checksums are compared with each other")
+	bindIP            = flag.String("bind-ip", "", "local IP address to source pings from")
+	vpnIP             = flag.String("vpn-ip", "", "VPN-assigned local IP to run a second, VPN-sourced set of pings from")
+	connectTimeoutMs  = flag.Int("connect-timeout-ms", 3000, "timeout in milliseconds for connecting to a region")
+	responseTimeoutMs = flag.Int("response-timeout-ms", 10000, "total timeout in milliseconds for a single ping attempt, connecting included")
+	icmpProbes        = flag.Int("icmp-probes", 5, "number of ICMP probes sent to the client to measure latency and packet loss")
+
+	// simulateRoute53 only mimics the requests. Real health checkers connect
+	// from the ranges AWS publishes for ROUTE53_HEALTHCHECKS in ip-ranges.json,
+	// so endpoints behind security groups must allow those ranges for real
+	// checks to match what this mode measures.
+	simulateRoute53 = flag.Bool("simulate-route53", false, "send pings with Route 53 health checker headers")
+
+	warmupAttempts = flag.Int("warmup-attempts", 0, "number of discarded pings sent to each region before the measured attempts")
+
+	headBodyLimit = flag.Int64("head-body-limit", 4096, "maximum bytes fetched to count an unexpected HEAD response body")
+
+	manualStart    = flag.Bool("manual-start", false, "show a Start Ping button instead of pinging on page load")
+	autoStartDelay = flag.Int("auto-start-delay", 0, "seconds to count down before pinging on page load")
+)
+
+// route53UserAgent is the User-Agent sent under --simulate-route53.
+const route53UserAgent = "Amazon Route53 Health Check"
+
+// pingAttempts is the number of pings per region; the fastest one is reported.
+const pingAttempts = 3
+
 type PingResult struct {
-	Region     string  `json:"region"`
-	Code       string  `json:"code"`
-	Latency    float64 `json:"latency"`
-	ClientPing float64 `json:"clientPing"`
-	Error      string  `json:"error,omitempty"`
+	Region           string  `json:"region"`
+	Code             string  `json:"code"`
+	Latency          float64 `json:"latency"`
+	ClientPing       float64 `json:"clientPing"`
+	ClientPacketLoss float64 `json:"clientPacketLoss"`
+	// ClientOutboundMs and ClientInboundMs split the client round trip into
+	// its legs using ICMP timestamps, under --icmp-timestamp. Each is off by
+	// the skew between the server's and client's clocks, so they are only
+	// meaningful when both are synced, e.g. over NTP.
+	ClientOutboundMs float64 `json:"clientOutboundMs,omitempty"`
+	ClientInboundMs  float64 `json:"clientInboundMs,omitempty"`
+	// ClientIPType classifies the client address as "cloud", "vpn" or
+	// "residential"; for the first two ClientPing is not the end user's.
+	ClientIPType string `json:"clientIPType,omitempty"`
+	Error        string `json:"error,omitempty"`
+	ErrorType    string `json:"errorType"`
+
+	// JitterMs and PacketLossPct describe the region's attempts, and with
+	// Latency decide QualityTier: "Excellent", "Good", "Fair" or "Poor".
+	JitterMs      float64 `json:"jitterMs"`
+	PacketLossPct float64 `json:"packetLossPct"`
+	QualityTier   string  `json:"qualityTier,omitempty"`
+
+	// SpikeDetected is set when one attempt took more than twice the fastest;
+	// SpikeLatencyMs is then the slowest attempt.
+	SpikeDetected  bool    `json:"spikeDetected,omitempty"`
+	SpikeLatencyMs float64 `json:"spikeLatencyMs,omitempty"`
+
+	// ICMPLatencyMs is a raw ICMP echo round trip to the S3 endpoint; it is
+	// only measured when the server may open raw sockets.
+	ICMPLatencyMs float64 `json:"icmpLatencyMs,omitempty"`
+	// PathMTU is the largest packet, headers included, that reached the
+	// endpoint unfragmented under --mtu-detect.
+	PathMTU int `json:"pathMTU,omitempty"`
+
+	// DNSResolvers lists what each --dns-resolvers resolver returned for the
+	// region. GeoDNSVariance is set when they returned different addresses,
+	// in which case each answer carries the latency to its address.
+	DNSResolvers   []ResolverAnswer `json:"dnsResolvers,omitempty"`
+	GeoDNSVariance bool             `json:"geoDNSVariance,omitempty"`
+
+	// WarmupMs is the cold-start cost: the first discarded ping under
+	// --warmup-attempts, otherwise the --prewarm TCP and TLS handshake time.
+	WarmupMs float64 `json:"warmupMs,omitempty"`
+
+	// ThroughputMbps is the --speed-test download rate in Mbit/s.
+	ThroughputMbps float64 `json:"throughputMbps,omitempty"`
+	// BDPBytes is the bandwidth-delay product of Latency and ThroughputMbps:
+	// the bytes in flight needed to keep the path full.
+	BDPBytes int64 `json:"bdpBytes,omitempty"`
+	// EstimatedCostPer100GbUSD is the egress cost of moving 100 GB out of
+	// the region, set alongside ThroughputMbps when --egress-pricing-url has
+	// a price for it.
+	EstimatedCostPer100GbUSD float64 `json:"estimatedCostPer100GbUsd,omitempty"`
+
+	// --tls-resumption-test handshake times of a fresh TLS connection and a
+	// second one that could resume its session. TLSResumptionActive is set
+	// when the second took under 60% of the first.
+	TLSFirstHandshakeMs   float64 `json:"tlsFirstHandshakeMs,omitempty"`
+	TLSResumedHandshakeMs float64 `json:"tlsResumedHandshakeMs,omitempty"`
+	TLSResumptionActive   bool    `json:"tlsResumptionActive,omitempty"`
+
+	// TLS parameters negotiated on the fastest attempt, and when the
+	// endpoint's leaf certificate expires (RFC 3339).
+	TLSVersion         string `json:"tlsVersion,omitempty"`
+	TLSCipherSuite     string `json:"tlsCipherSuite,omitempty"`
+	TLSNegotiatedProto string `json:"tlsNegotiatedProto,omitempty"`
+	TLSCertExpiry      string `json:"tlsCertExpiry,omitempty"`
+	// CertPinned is set when the verified chain includes a CA from
+	// awsCAPins; otherwise Warning says so.
+	CertPinned bool `json:"certPinned,omitempty"`
+
+	// ECNSupported is set by --ecn-check when a connection to the region
+	// negotiated Explicit Congestion Notification.
+	ECNSupported bool `json:"ecnSupported,omitempty"`
+
+	// Samples holds every attempt's raw duration in milliseconds, with the
+	// matching HTTP status or error at the same index in Attempts.
+	Samples  []float64     `json:"samples,omitempty"`
+	Attempts []PingAttempt `json:"attempts,omitempty"`
+
+	// URL is the exact endpoint URL, nonce included, of the reported ping.
+	URL string `json:"url,omitempty"`
+
+	// Deprecated is set under --check-deprecated for regions AWS no longer
+	// lists in ip-ranges.json.
+	Deprecated bool `json:"deprecated,omitempty"`
+
+	// RequestID is the X-Request-ID sent with the pings, taken from the
+	// incoming request when a load balancer set one. A stream following
+	// another's run gets the leading stream's ID, which its pings went out
+	// under; the stream's own ID is in its run_start event.
+	RequestID string `json:"requestId,omitempty"`
+
+	// SourceTag tells direct pings from --vpn-ip pings apart.
+	SourceTag string `json:"sourceTag,omitempty"`
+	// SourceIP is the local address an /api/load-test ping was sent from.
+	SourceIP string `json:"sourceIP,omitempty"`
+
+	// Trend compares Latency with the previous run: "up" (worse), "down"
+	// (better) or "stable" (under 5% change). TrendDeltaMs is the change.
+	Trend        string  `json:"trend,omitempty"`
+	TrendDeltaMs float64 `json:"trendDeltaMs,omitempty"`
+
+	// BaselineDeltaMs is Latency minus the region's latency in the baseline
+	// run kept by --baseline-on-start or --baseline-file.
+	BaselineDeltaMs float64 `json:"baselineDeltaMs,omitempty"`
+
+	// ServerRegion is the AWS region the server itself runs in, if known.
+	ServerRegion string `json:"serverRegion,omitempty"`
+
+	// Timestamp is when the result was emitted on the SSE stream (RFC 3339).
+	Timestamp string `json:"timestamp,omitempty"`
+
+	ProxyDetected bool   `json:"proxyDetected,omitempty"`
+	ServedFromCDN bool   `json:"servedFromCDN,omitempty"`
+	CacheStatus   string `json:"cacheStatus,omitempty"`
+
+	// S3RequestID, S3EdgeID and S3Server are the x-amz-request-id,
+	// x-amz-id-2 and Server headers of the fastest response. x-amz-id-2 is
+	// an opaque token that identifies the S3 host that served the request,
+	// so it differing between runs means a different host answered.
+	S3RequestID string `json:"s3RequestId,omitempty"`
+	S3EdgeID    string `json:"s3EdgeId,omitempty"`
+	S3Server    string `json:"s3Server,omitempty"`
+
+	// VPCEndpoint is set when the endpoint resolved to a private address.
+	VPCEndpoint bool `json:"vpcEndpoint,omitempty"`
+
+	// IPVerified reports, with --verify-aws-ips, whether the endpoint's
+	// public address is in AWS's published S3 ranges. Warning lists every
+	// failed check, separated by "; ".
+	IPVerified *bool  `json:"ipVerified,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+
+	// ServiceHealth is S3's status in the region on the AWS Service Health
+	// Dashboard, set by --check-aws-health. Unless it is healthy,
+	// ServiceHealthIncident is the title of the latest dashboard entry.
+	ServiceHealth         string `json:"serviceHealth,omitempty"`
+	ServiceHealthIncident string `json:"serviceHealthIncident,omitempty"`
+
+	// ProxyBodyBytes is how much body the HEAD ping's response announced,
+	// which a well-behaved server never does, as counted by a bounded GET.
+	ProxyBodyBytes int `json:"proxyBodyBytes,omitempty"`
+
+	BudgetPercent   float64 `json:"budgetPercent,omitempty"`
+	BudgetRemaining float64 `json:"budgetRemaining,omitempty"`
+}
+
+// RunStartEvent is sent as the run_start SSE event before any pings start.
+type RunStartEvent struct {
+	StartedAt string `json:"started_at"`
+	// RegionCount is how many results the stream will send, so under
+	// --vpn-ip it counts every region twice.
+	RegionCount int `json:"region_count"`
+	// RequestID identifies this stream, e.g. for POST /api/client-timing.
+	RequestID string `json:"request_id"`
+	// Replay is set when the results are recorded ones streamed by --replay.
+	Replay bool `json:"replay,omitempty"`
+	// Stale is set when the results are the run restored from --cache-file,
+	// completed CacheAgeSeconds ago, rather than fresh pings.
+	Stale           bool `json:"stale,omitempty"`
+	CacheAgeSeconds int  `json:"cache_age_seconds,omitempty"`
+}
+
+// RunCompleteEvent is sent as the run_complete SSE event after the last
+// result. The gap between the first and last result shows how evenly the
+// regions responded.
+type RunCompleteEvent struct {
+	CompletedAt   string `json:"completed_at"`
+	DurationMs    int64  `json:"duration_ms"`
+	FirstResultMs int64  `json:"first_result_ms"`
+	LastResultMs  int64  `json:"last_result_ms"`
+	// RunBytesSent and RunBytesReceived are how far the primary interface's
+	// counters moved during the stream. They include any other traffic on
+	// the host and are omitted where the counters can't be read.
+	RunBytesSent     int64 `json:"run_bytes_sent,omitempty"`
+	RunBytesReceived int64 `json:"run_bytes_received,omitempty"`
+}
+
+// PingAttempt describes the outcome of one attempt against a region.
+type PingAttempt struct {
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// icmpSourceIP is the local address client ICMP pings are sent from. It
+// defaults to --bind-ip; without one, --ecs-metadata sets it to the task IP.
+var icmpSourceIP string
+
+// pingHTTPClient is shared by all pings so connections to a region are reused
+// across attempts. It is built on first use, after flags have been parsed.
+var pingHTTPClient = sync.OnceValue(func() *http.Client {
+	return newPingClient(*bindIP)
+})
+
+// vpnHTTPClient sources pings from --vpn-ip for the VPN half of a run.
+var vpnHTTPClient = sync.OnceValue(func() *http.Client {
+	return newPingClient(*vpnIP)
+})
+
+func init() {
+	// --ping-timeout predates the split into connect and response timeouts
+	// and is kept as an alias for --response-timeout-ms.
+	flag.Func("ping-timeout", "deprecated: use --response-timeout-ms", func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*responseTimeoutMs = int(d.Milliseconds())
+		return nil
+	})
+}
+
+func connectTimeout() time.Duration {
+	return time.Duration(*connectTimeoutMs) * time.Millisecond
+}
+
+func responseTimeout() time.Duration {
+	return time.Duration(*responseTimeoutMs) * time.Millisecond
 }
 
-func pingRegion(region awsping.AWSRegion) (time.Duration, error) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
+// newPingClient returns an HTTP client for S3 pings, sourcing connections
+// from localIP when it is set.
+func newPingClient(localIP string) *http.Client {
+	return newPingClientWithKeepAlive(localIP, tcpKeepAlive())
+}
+
+// newPingClientWithKeepAlive is newPingClient with an explicit TCP
+// keep-alive period; a negative one disables keep-alive probes.
+func newPingClientWithKeepAlive(localIP string, keepAlive time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout(),
+		KeepAlive: keepAlive,
 	}
+	if localIP != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(localIP)}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialPrefetched(dialer.DialContext)
+
+	return &http.Client{
+		Timeout:   responseTimeout(),
+		Transport: transport,
+	}
+}
 
-	url := fmt.Sprintf("https://s3.%s.amazonaws.com/?ping=%d", region.Code, time.Now().UnixNano())
-	req, err := http.NewRequest("HEAD", url, nil)
+// validateBindIP checks that ipStr is assigned to one of the local interfaces.
+func validateBindIP(ipStr string) error {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return fmt.Errorf("invalid bind IP address: %s", ipStr)
+	}
+
+	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("listing interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("bind IP %s is not assigned to any local interface", ipStr)
+}
+
+// pingSample is the outcome of one successful HEAD ping.
+type pingSample struct {
+	latency time.Duration
+	// resp has already had its body closed and is only useful for
+	// inspecting headers and connection state.
+	resp *http.Response
+	// bodyBytes counts the body a response announced despite the HEAD, up to
+	// --head-body-limit.
+	bodyBytes int
+	// remoteIP is the address the request was actually sent to.
+	remoteIP net.IP
+}
+
+// pingRegion times a single HEAD request to the region's S3 endpoint. A
+// non-empty requestID is sent as X-Request-ID for end-to-end tracing.
+// Prefetched ips, if any, are dialed instead of resolving the hostname.
+func pingRegion(ctx context.Context, client *http.Client, region awsping.AWSRegion, requestID string, ips []net.IP) (*pingSample, error) {
+	sample := &pingSample{}
+	// GotConn also fires for reused connections, where no DNS lookup happens,
+	// so the resolved address is taken from the connection itself.
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				sample.remoteIP = addr.IP
+			}
+		},
+	}
+
+	url := fmt.Sprintf("%s?ping=%d", endpointURL(region), time.Now().UnixNano())
+	ctx = withPrefetchedIPs(httptrace.WithClientTrace(ctx, trace), regionHostname(region), ips)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	if *simulateRoute53 {
+		// Route 53 health checkers name the endpoint explicitly in Host and
+		// identify themselves in User-Agent.
+		req.Host = req.URL.Host
+		req.Header.Set("User-Agent", route53UserAgent)
 	}
 
 	start := time.Now()
 	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	sample.latency = time.Since(start)
+	sample.resp = resp
+
+	// The transport never reads a body after a HEAD, so resp.Body is always
+	// empty. Broken proxies answering with a full error page give themselves
+	// away in the headers instead, and the page is then fetched with a
+	// bounded GET to count it.
+	resp.Body.Close()
+	if resp.ContentLength > 0 || slices.Contains(resp.TransferEncoding, "chunked") {
+		n, err := countBody(ctx, client, req)
+		if err != nil {
+			log.Printf("Error fetching the body announced by %s's HEAD response: %v", region.Code, err)
+		} else if n > 0 {
+			log.Printf("Warning: HEAD response from %s carried %d unexpected body bytes", region.Code, n)
+		}
+		sample.bodyBytes = int(n)
+	}
+
+	return sample, nil
+}
+
+// countBody repeats a HEAD request as a GET for at most --head-body-limit
+// bytes and returns how many came back.
+func countBody(ctx context.Context, client *http.Client, head *http.Request) (int64, error) {
+	req := head.Clone(ctx)
+	req.Method = http.MethodGet
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", *headBodyLimit-1))
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
+	return io.Copy(io.Discard, io.LimitReader(resp.Body, *headBodyLimit))
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// detectProxy sends GET probes carrying a unique X-Probe-ID header and checks
+// that the responses still look like they came straight from S3. A proxy is
+// assumed when an echoed probe ID has been altered, the S3 request ID header
+// has been stripped, or two identical probes return different bodies.
+// There is no S3 object with a known checksum to fetch, so the second probe
+// stands in for one.
+func detectProxy(ctx context.Context, region awsping.AWSRegion) (bool, error) {
+	client := pingHTTPClient()
+
+	probe := func() (checksum string, tampered bool, err error) {
+		probeID := newUUID()
+		url := fmt.Sprintf("%s?probe=%s", endpointURL(region), probeID)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return "", false, err
+		}
+		req.Header.Set("X-Probe-ID", probeID)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", false, err
+		}
+		defer resp.Body.Close()
 
-	return time.Since(start), nil
+		requestID := resp.Header.Get("X-Amz-Request-Id")
+		if echoed := resp.Header.Get("X-Probe-ID"); echoed != "" && echoed != probeID {
+			tampered = true
+		}
+		if requestID == "" {
+			tampered = true
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return "", false, err
+		}
+		// S3 embeds the per-request IDs in error bodies; drop them so that two
+		// probes of the same resource produce the same checksum.
+		text := string(body)
+		for _, id := range []string{requestID, resp.Header.Get("X-Amz-Id-2")} {
+			if id != "" {
+				text = strings.ReplaceAll(text, id, "")
+			}
+		}
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:]), tampered, nil
+	}
+
+	first, tampered, err := probe()
+	if err != nil || tampered {
+		return tampered, err
+	}
+	second, tampered, err := probe()
+	if err != nil || tampered {
+		return tampered, err
+	}
+	return first != second, nil
 }
 
-func pingClient(ipStr string) float64 {
+// icmpProbeInterval is the gap between consecutive client ICMP probes.
+const icmpProbeInterval = 200 * time.Millisecond
+
+// pingClient sends --icmp-probes ICMP echoes to the client and returns the
+// fastest round trip in milliseconds along with the percentage of probes that
+// went unanswered. Both are 0 if the probes could not be sent at all.
+func pingClient(ipStr string) (latency float64, packetLoss float64) {
 	// Parse IP address
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		log.Printf("Invalid IP address: %s", ipStr)
-		return 0
+		return 0, 0
 	}
 
 	// Create ICMP connection using unprivileged UDP
-	c, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	listenAddr := "0.0.0.0"
+	if icmpSourceIP != "" {
+		listenAddr = icmpSourceIP
+	}
+	c, err := icmp.ListenPacket("udp4", listenAddr)
 	if err != nil {
 		log.Printf("Error creating ICMP connection: %v", err)
-		return 0
+		return 0, 0
 	}
 	defer c.Close()
 
-	// Create ICMP message
-	msg := icmp.Message{
-		Type: ipv4.ICMPTypeEcho,
-		Code: 0,
-		Body: &icmp.Echo{
-			ID:   os.Getpid() & 0xffff,
-			Seq:  1,
-			Data: []byte("PING"),
-		},
+	probes := *icmpProbes
+	if probes < 1 {
+		probes = 1
 	}
 
-	// Serialize message
-	msgBytes, err := msg.Marshal(nil)
+	// Collect replies until every probe has had the full timeout to come back
+	err = c.SetReadDeadline(time.Now().Add(time.Duration(probes)*icmpProbeInterval + time.Second*2))
 	if err != nil {
-		log.Printf("Error marshaling ICMP message: %v", err)
-		return 0
+		log.Printf("Error setting read deadline: %v", err)
+		return 0, 0
 	}
 
-	// Send ping and measure time
-	start := time.Now()
-	_, err = c.WriteTo(msgBytes, &net.UDPAddr{IP: ip})
-	if err != nil {
-		log.Printf("Error sending ICMP packet: %v", err)
-		return 0
+	var mu sync.Mutex
+	sentAt := make([]time.Time, probes+1)
+	rtts := make(map[int]time.Duration, probes)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reply := make([]byte, 1500)
+		for {
+			n, _, err := c.ReadFrom(reply)
+			if err != nil {
+				// Deadline reached or socket closed
+				return
+			}
+			received := time.Now()
+
+			// Parse reply
+			msg, err := icmp.ParseMessage(1, reply[:n]) // Use 1 for ICMP protocol number
+			if err != nil {
+				log.Printf("Error parsing ICMP reply: %v", err)
+				continue
+			}
+			echo, ok := msg.Body.(*icmp.Echo)
+			if msg.Type != ipv4.ICMPTypeEchoReply || !ok {
+				continue
+			}
+
+			mu.Lock()
+			if echo.Seq >= 1 && echo.Seq <= probes && !sentAt[echo.Seq].IsZero() {
+				if _, dup := rtts[echo.Seq]; !dup {
+					rtts[echo.Seq] = received.Sub(sentAt[echo.Seq])
+				}
+			}
+			complete := len(rtts) == probes
+			mu.Unlock()
+			if complete {
+				return
+			}
+		}
+	}()
+
+	sent := 0
+	for seq := 1; seq <= probes; seq++ {
+		// Create ICMP message
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Code: 0,
+			Body: &icmp.Echo{
+				ID:   os.Getpid() & 0xffff,
+				Seq:  seq,
+				Data: []byte("PING"),
+			},
+		}
+
+		// Serialize message
+		msgBytes, err := msg.Marshal(nil)
+		if err != nil {
+			log.Printf("Error marshaling ICMP message: %v", err)
+			break
+		}
+
+		mu.Lock()
+		sentAt[seq] = time.Now()
+		mu.Unlock()
+		if _, err = c.WriteTo(msgBytes, &net.UDPAddr{IP: ip}); err != nil {
+			log.Printf("Error sending ICMP packet: %v", err)
+			break
+		}
+		sent++
+
+		if seq < probes {
+			time.Sleep(icmpProbeInterval)
+		}
 	}
 
-	// Wait for reply
-	reply := make([]byte, 1500)
-	err = c.SetReadDeadline(time.Now().Add(time.Second * 2))
-	if err != nil {
-		log.Printf("Error setting read deadline: %v", err)
-		return 0
+	if sent == 0 {
+		return 0, 0
 	}
+	<-done
 
-	n, _, err := c.ReadFrom(reply)
-	if err != nil {
-		log.Printf("Error reading ICMP reply: %v", err)
-		return 0
+	mu.Lock()
+	defer mu.Unlock()
+
+	var fastest time.Duration
+	for _, rtt := range rtts {
+		if fastest == 0 || rtt < fastest {
+			fastest = rtt
+		}
 	}
+	packetLoss = float64(sent-len(rtts)) / float64(sent) * 100
+	return float64(fastest.Milliseconds()), packetLoss
+}
 
-	duration := time.Since(start)
+// runOptions carries the per-run settings that vary between callers.
+// Per-client fields such as ClientPing and the latency budget are filled in
+// by the caller, since one run may be shared by several clients.
+type runOptions struct {
+	// sourceTag selects the source address: sourceTagVPN pings from
+	// --vpn-ip, anything else from the default route or --bind-ip.
+	sourceTag string
+	// requestID is propagated to every ping as X-Request-ID.
+	requestID string
+	// resolved holds addresses prefetched by hostname; hosts missing from
+	// it are resolved when pinged.
+	resolved map[string][]net.IP
+	// s3Prefixes, when set, are the published ranges endpoint addresses are
+	// verified against.
+	s3Prefixes []*net.IPNet
+}
 
-	// Parse reply
-	_, err = icmp.ParseMessage(1, reply[:n]) // Use 1 for ICMP protocol number
-	if err != nil {
-		log.Printf("Error parsing ICMP reply: %v", err)
-		return 0
+// Source tags for PingResult.SourceTag.
+const (
+	sourceTagDirect = "direct"
+	sourceTagVPN    = "vpn"
+)
+
+// runPings pings every region concurrently and delivers each result as soon
+// as it is ready. The channel is closed once all regions have finished.
+func runPings(ctx context.Context, regions []awsping.AWSRegion, opts runOptions) <-chan PingResult {
+	log.Printf("Got %d regions to ping", len(regions))
+	opts.resolved = prefetchDNS(ctx, regions)
+	if *verifyAWSIPs {
+		prefixes, err := loadS3Prefixes()
+		if err != nil {
+			log.Printf("Error loading AWS IP ranges, skipping IP verification: %v", err)
+		}
+		opts.s3Prefixes = prefixes
 	}
 
-	return float64(duration.Milliseconds())
+	results := make(chan PingResult, len(regions))
+	var wg sync.WaitGroup
+	wg.Add(len(regions))
+
+	for i := range regions {
+		go func(region awsping.AWSRegion) {
+			defer wg.Done()
+			health := startHealthCheck(ctx, region.Code)
+			result := pingRegionResult(ctx, region, opts)
+			applyServiceHealth(&result, health)
+			results <- result
+		}(regions[i])
+	}
+
+	go func() {
+		wg.Wait()
+		log.Println("All pings completed, closing results channel")
+		close(results)
+	}()
+
+	return results
+}
+
+// mergeResults forwards results from both channels until both are closed.
+func mergeResults(a, b <-chan PingResult) <-chan PingResult {
+	merged := make(chan PingResult)
+	go func() {
+		defer close(merged)
+		for a != nil || b != nil {
+			select {
+			case result, ok := <-a:
+				if !ok {
+					a = nil
+					continue
+				}
+				merged <- result
+			case result, ok := <-b:
+				if !ok {
+					b = nil
+					continue
+				}
+				merged <- result
+			}
+		}
+	}()
+	return merged
+}
+
+// pingRegionResult runs all attempts against one region and builds its result.
+func pingRegionResult(parent context.Context, region awsping.AWSRegion, opts runOptions) PingResult {
+	log.Printf("Starting ping for region: %s", region.Code)
+
+	// Each region gets every attempt's timeout plus a 10% buffer, after which
+	// any hung request is cancelled so the stream is never held up longer.
+	totalAttempts := time.Duration(pingAttempts + max(*warmupAttempts, 0))
+	regionDeadline := time.Duration(float64(responseTimeout()*totalAttempts) * 1.1)
+	ctx, cancel := context.WithTimeout(parent, regionDeadline)
+	defer cancel()
+
+	result := PingResult{
+		Region:       region.Name,
+		Code:         region.Code,
+		ErrorType:    errorTypeNone,
+		ServerRegion: serverRegion,
+		SourceTag:    opts.sourceTag,
+		RequestID:    opts.requestID,
+		Deprecated:   isDeprecatedRegion(region.Code),
+	}
+
+	if *prewarm {
+		warmup, err := prewarmRegion(ctx, region)
+		if err != nil {
+			log.Printf("Error pre-warming %s: %v", region.Code, err)
+		} else {
+			result.WarmupMs = float64(warmup) / float64(time.Millisecond)
+		}
+	}
+
+	client := pingHTTPClient()
+	if opts.sourceTag == sourceTagVPN {
+		client = vpnHTTPClient()
+	}
+	ips := opts.resolved[regionHostname(region)]
+
+	// Warm-up pings absorb the cold DNS cache and TCP/TLS setup and are left
+	// out of every statistic except WarmupMs.
+	for i := 0; i < *warmupAttempts && ctx.Err() == nil; i++ {
+		sample, err := pingRegion(ctx, client, region, opts.requestID, ips)
+		if err != nil {
+			log.Printf("Error in warm-up ping to %s: %v", region.Code, err)
+			continue
+		}
+		if i == 0 {
+			result.WarmupMs = float64(sample.latency) / float64(time.Millisecond)
+		}
+	}
+
+	var minLatency time.Duration
+	var fastest *http.Response
+	var remoteIP net.IP
+	var lastError error
+	var samples []time.Duration
+
+attempts:
+	for i := 0; i < pingAttempts; i++ {
+		start := time.Now()
+		sample, err := pingRegion(ctx, client, region, opts.requestID, ips)
+		if err != nil {
+			result.Samples = append(result.Samples, float64(time.Since(start))/float64(time.Millisecond))
+			result.Attempts = append(result.Attempts, PingAttempt{Error: err.Error()})
+			lastError = err
+			var urlErr *url.Error
+			if minLatency == 0 && errors.As(err, &urlErr) {
+				result.URL = urlErr.URL
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		samples = append(samples, sample.latency)
+		result.Samples = append(result.Samples, float64(sample.latency)/float64(time.Millisecond))
+		result.Attempts = append(result.Attempts, PingAttempt{Status: sample.resp.StatusCode})
+		if minLatency == 0 || sample.latency < minLatency {
+			minLatency = sample.latency
+			fastest = sample.resp
+			result.ProxyBodyBytes = sample.bodyBytes
+			result.URL = sample.resp.Request.URL.String()
+			// A private address means DNS pointed at an S3 VPC endpoint,
+			// so the traffic never leaves the VPC.
+			result.VPCEndpoint = sample.remoteIP != nil && sample.remoteIP.IsPrivate()
+			remoteIP = sample.remoteIP
+		}
+		select {
+		case <-ctx.Done():
+			break attempts
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+	if minLatency == 0 && ctx.Err() == context.DeadlineExceeded {
+		lastError = &regionTimeoutError{after: regionDeadline}
+	}
+
+	result.Latency = float64(minLatency.Milliseconds())
+	if len(result.Attempts) > 0 {
+		result.PacketLossPct = float64(len(result.Attempts)-len(samples)) / float64(len(result.Attempts)) * 100
+	}
+
+	if minLatency == 0 && lastError != nil {
+		result.Error = lastError.Error()
+		result.ErrorType = classifyError(lastError)
+		log.Printf("Error pinging %s: %v", region.Code, lastError)
+		return result
+	}
+
+	log.Printf("Successfully pinged %s: %.2fms", region.Code, result.Latency)
+
+	// The minimum hides bursty paths, so flag runs where any attempt was
+	// more than twice as slow as the fastest one.
+	var slowest time.Duration
+	for _, sample := range samples {
+		slowest = max(slowest, sample)
+	}
+	if slowest > 2*minLatency {
+		result.SpikeDetected = true
+		result.SpikeLatencyMs = float64(slowest.Milliseconds())
+		log.Printf("Latency spike for %s: %.2fms vs %.2fms minimum", region.Code, result.SpikeLatencyMs, result.Latency)
+	}
+
+	result.JitterMs = math.Round(jitterMs(samples)*100) / 100
+	result.QualityTier = qualityTier(result.Latency, result.JitterMs, result.PacketLossPct)
+
+	// CloudFront stamps its responses; when present the latency
+	// reflects the edge location rather than the S3 origin.
+	result.CacheStatus = fastest.Header.Get("X-Cache")
+	result.ServedFromCDN = result.CacheStatus != "" || fastest.Header.Get("X-Amz-Cf-Id") != ""
+	result.S3RequestID = fastest.Header.Get("X-Amz-Request-Id")
+	result.S3EdgeID = fastest.Header.Get("X-Amz-Id-2")
+	result.S3Server = fastest.Header.Get("Server")
+
+	// An address outside the published ranges hints at DNS hijacking or a
+	// routing anomaly. VPC endpoints and Consul targets are never in them.
+	if opts.s3Prefixes != nil && remoteIP != nil && !result.VPCEndpoint && !strings.HasPrefix(region.Code, consulCodePrefix) {
+		verified := inPrefixes(remoteIP, opts.s3Prefixes)
+		result.IPVerified = &verified
+		if !verified {
+			addWarning(&result, "IP not in AWS published ranges")
+			log.Printf("Warning: %s resolved to %s, which is not in AWS's published S3 ranges", region.Code, remoteIP)
+		}
+	}
+
+	if state := fastest.TLS; state != nil {
+		result.TLSVersion = tls.VersionName(state.Version)
+		result.TLSCipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		result.TLSNegotiatedProto = state.NegotiatedProtocol
+		if len(state.PeerCertificates) > 0 {
+			result.TLSCertExpiry = state.PeerCertificates[0].NotAfter.UTC().Format(time.RFC3339)
+		}
+		if !strings.HasPrefix(region.Code, consulCodePrefix) {
+			result.CertPinned = len(state.VerifiedChains) > 0 && chainPinned(state.VerifiedChains[0])
+			if !result.CertPinned {
+				addWarning(&result, "certificate not pinned to known AWS CA")
+			}
+		}
+	}
+
+	// ICMP skips TCP and TLS entirely, so comparing it with the HTTP
+	// latency shows how much of the ping is protocol overhead. Consul
+	// targets have no S3 hostname to compare with.
+	if !strings.HasPrefix(region.Code, consulCodePrefix) {
+		if rtt, err := icmpPingRegion(ctx, region); err == nil {
+			result.ICMPLatencyMs = float64(rtt) / float64(time.Millisecond)
+		} else if err != errICMPUnavailable && ctx.Err() == nil {
+			log.Printf("Error sending ICMP ping to %s: %v", region.Code, err)
+		}
+	}
+	if len(resolverIPs) > 0 && !strings.HasPrefix(region.Code, consulCodePrefix) {
+		result.DNSResolvers, result.GeoDNSVariance = compareResolvers(ctx, region, resolverIPs)
+	}
+	if *mtuDetect {
+		payload, err := detectMTU(ctx, regionHostname(region))
+		switch {
+		case err == nil:
+			result.PathMTU = payload + icmpEchoOverhead
+			if result.PathMTU < lowPathMTU {
+				addWarning(&result, fmt.Sprintf("path MTU %d may cause fragmentation", result.PathMTU))
+			}
+		case err != errICMPUnavailable && err != errMTUUnavailable && ctx.Err() == nil:
+			log.Printf("Error detecting path MTU to %s: %v", region.Code, err)
+		}
+	}
+
+	if *speedTest {
+		mbps, ok, err := measureThroughput(ctx, region)
+		switch {
+		case err != nil:
+			log.Printf("Error running speed test for %s: %v", region.Code, err)
+		case !ok:
+			log.Printf("No speed test object for %s, skipping", region.Code)
+		default:
+			result.ThroughputMbps = math.Round(mbps*100) / 100
+			result.BDPBytes = int64(result.Latency / 1000 * (mbps * 1e6 / 8))
+			if cost, ok := egressCostPer100GB(region.Code); ok {
+				result.EstimatedCostPer100GbUSD = cost
+			}
+		}
+	}
+
+	if *tlsResumptionTest {
+		first, resumed, err := measureTLSResumption(ctx, region)
+		switch {
+		case err == errNoTLSHandshake:
+		case err != nil:
+			log.Printf("Error testing TLS resumption for %s: %v", region.Code, err)
+		default:
+			result.TLSFirstHandshakeMs = float64(first) / float64(time.Millisecond)
+			result.TLSResumedHandshakeMs = float64(resumed) / float64(time.Millisecond)
+			result.TLSResumptionActive = resumed < first*6/10
+		}
+	}
+
+	if *ecnCheck {
+		supported, err := checkECN(ctx, region)
+		switch {
+		case err == errECNUnavailable:
+		case err != nil:
+			log.Printf("Error checking ECN for %s: %v", region.Code, err)
+		default:
+			result.ECNSupported = supported
+		}
+	}
+
+	// Consul targets aren't S3, so they never send an S3 request ID.
+	if *probeProxy && !strings.HasPrefix(region.Code, consulCodePrefix) {
+		detected, err := detectProxy(ctx, region)
+		if err != nil {
+			log.Printf("Error probing %s for proxies: %v", region.Code, err)
+		} else if detected {
+			result.ProxyDetected = true
+			log.Printf("Transparent proxy detected for %s", region.Code)
+		}
+	}
+
+	return result
+}
+
+// addWarning appends a warning to any the result already has.
+func addWarning(result *PingResult, warning string) {
+	if result.Warning != "" {
+		result.Warning += "; "
+	}
+	result.Warning += warning
+}
+
+// applyBudget records how much of a latency budget a successful result used.
+func applyBudget(result *PingResult, budget float64) {
+	if budget > 0 && result.Error == "" {
+		result.BudgetPercent = result.Latency / budget * 100
+		result.BudgetRemaining = budget - result.Latency
+	}
+}
+
+// runIntegrations tracks the webhooks finishRun fires in the background, so
+// a process about to exit can wait for them.
+var runIntegrations sync.WaitGroup
+
+// finishRun records a completed run and fires the post-run integrations. It
+// returns the geo-fence's verdict on whether the server appears to have
+// moved since the baseline run.
+func finishRun(results []PingResult) *LocationChange {
+	setLastRun(results)
+	recordHistory(results)
+	if len(sloDefinitions) > 0 {
+		recordSLOs(results)
+	}
+	if *baselineOnStart {
+		recordBaseline(results)
+	}
+
+	if *rankChangeWebhook != "" {
+		runIntegrations.Add(1)
+		go func() {
+			defer runIntegrations.Done()
+			checkRankChanges(results)
+		}()
+	}
+	if *onCompleteWebhook != "" {
+		runIntegrations.Add(1)
+		go func() {
+			defer runIntegrations.Done()
+			postRunComplete(results)
+		}()
+	}
+	if *cacheFile != "" {
+		if err := saveResultCache(results); err != nil {
+			log.Printf("Error saving result cache: %v", err)
+		}
+	}
+	return checkGeoFence(results)
 }
 
 func streamHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Starting new ping request...")
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newUUID()
+	}
+	log.Printf("Starting new ping request %s...", requestID)
+
+	// Optional latency budget in milliseconds
+	var budget float64
+	if v := r.URL.Query().Get("budget_ms"); v != "" {
+		var err error
+		budget, err = strconv.ParseFloat(v, 64)
+		if err != nil || budget <= 0 {
+			http.Error(w, "budget_ms must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional field projection, e.g. ?fields=code,latency,error
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get client IP
 	ip := r.Header.Get("X-Forwarded-For")
@@ -124,8 +1022,30 @@ func streamHandler(w http.ResponseWriter, r *http.Request) {
 			ip = ip[:colonIndex]
 		}
 	}
-	clientPing := pingClient(ip)
-	log.Printf("Client ping to %s: %.2fms", ip, clientPing)
+	clientPing, clientPacketLoss := pingClient(ip)
+	log.Printf("Client ping to %s: %.2fms, %.0f%% packet loss", ip, clientPing, clientPacketLoss)
+	clientIPType := classifyClientIP(ip)
+	var clientOutbound, clientInbound float64
+	if *icmpTimestamp {
+		var err error
+		clientOutbound, clientInbound, err = measureOneWayDelays(ip)
+		if err == nil {
+			log.Printf("Client one-way delays to %s: %.0fms out, %.0fms in", ip, clientOutbound, clientInbound)
+		} else if err != errICMPUnavailable {
+			log.Printf("Error measuring one-way delays to %s: %v", ip, err)
+		}
+	}
+
+	// The first stream after a restart is sent the run restored from
+	// --cache-file straight away instead of waiting for fresh pings.
+	var stale []PingResult
+	var cacheAge int
+	if *replayFile == "" {
+		if results, completedAt, ok := takeStaleRun(); ok {
+			stale, cacheAge = results, int(time.Since(completedAt).Seconds())
+			w.Header().Set("X-Cache-Age", strconv.Itoa(cacheAge))
+		}
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -138,60 +1058,140 @@ func streamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	regions := awsping.GetRegions()
-	log.Printf("Got %d regions to ping", len(regions))
-
-	results := make(chan PingResult, len(regions))
-	var wg sync.WaitGroup
-	wg.Add(len(regions))
-
-	for i := range regions {
-		go func(region awsping.AWSRegion) {
-			defer wg.Done()
-
-			log.Printf("Starting ping for region: %s", region.Code)
-
-			var minLatency time.Duration
-			var lastError error
+	regions := getRegions()
+	replaying := *replayFile != ""
+	regionCount := len(regions)
+	if *vpnIP != "" {
+		// Each region is pinged both directly and over the VPN.
+		regionCount *= 2
+	}
+	if replaying {
+		regionCount = len(replayedResults)
+	} else if stale != nil {
+		regionCount = len(stale)
+	}
+	startedAt := time.Now()
+	writeSSEEvent(w, flusher, "run_start", RunStartEvent{
+		StartedAt:       startedAt.UTC().Format(time.RFC3339),
+		RegionCount:     regionCount,
+		RequestID:       requestID,
+		Replay:          replaying,
+		Stale:           stale != nil,
+		CacheAgeSeconds: cacheAge,
+	})
 
-			for i := 0; i < 3; i++ {
-				latency, err := pingRegion(region)
-				if err != nil {
-					lastError = err
-					continue
-				}
-				if minLatency == 0 || latency < minLatency {
-					minLatency = latency
-				}
-				time.Sleep(time.Millisecond * 100)
-			}
+	// Without an ICMP client ping the browser measures its own round trip
+	// and reports it through /api/client-timing.
+	if clientPing == 0 {
+		registerClientTiming(requestID)
+		defer unregisterClientTiming(requestID)
+	}
+	applyClientTiming := func() {
+		if ms, ok := takeClientTiming(requestID); ok {
+			clientPing = ms
+			writeSSEEvent(w, flusher, "client_timing_update", ClientTimingUpdate{ClientPingMs: ms})
+		}
+	}
 
-			result := PingResult{
-				Region:     region.Name,
-				Code:       region.Code,
-				Latency:    float64(minLatency.Milliseconds()),
-				ClientPing: clientPing,
+	var run *sharedRun
+	var leader bool
+	if replaying {
+		// Each stream gets its own replay, and no stream leads it, so
+		// recorded results are never recorded as a run.
+		run = newRun(replayResults(r.Context(), replayedResults, *replaySpeed))
+	} else if stale != nil {
+		// Likewise the restored run, which is already the last run.
+		run = newRun(cachedResults(stale))
+	} else {
+		// Concurrent streams for the same run parameters follow one shared
+		// run. It is not tied to any one client's request, so a disconnecting
+		// client doesn't cut the stream short for the others.
+		//
+		// Starting a run needs one of --max-concurrent-runs slots, which the
+		// leader holds until the run has finished.
+		key := runKey(regions)
+		var following bool
+		run, following = followRun(key)
+		if !following {
+			admitted := acquireRunSlot(r.Context(), func(position int) {
+				log.Printf("Request %s queued for a run slot at position %d", requestID, position)
+				writeSSEEvent(w, flusher, "run_queued", RunQueuedEvent{Position: position})
+			})
+			if !admitted {
+				return
 			}
-
-			if minLatency == 0 && lastError != nil {
-				result.Error = lastError.Error()
-				log.Printf("Error pinging %s: %v", region.Code, lastError)
+			run, leader = joinRun(key, requestID, func() <-chan PingResult {
+				opts := runOptions{requestID: requestID}
+				if *vpnIP == "" {
+					return runPings(context.Background(), regions, opts)
+				}
+				opts.sourceTag = sourceTagDirect
+				vpnOpts := opts
+				vpnOpts.sourceTag = sourceTagVPN
+				return mergeResults(runPings(context.Background(), regions, opts), runPings(context.Background(), regions, vpnOpts))
+			})
+			// Another stream may have started the same run while this one
+			// waited for its slot.
+			if leader {
+				defer releaseRunSlot()
 			} else {
-				log.Printf("Successfully pinged %s: %.2fms", region.Code, result.Latency)
+				releaseRunSlot()
 			}
-
-			results <- result
-		}(regions[i])
+		}
+		if !leader {
+			log.Printf("Request %s joined the in-flight run of request %s", requestID, run.requestID)
+		}
 	}
 
-	go func() {
-		wg.Wait()
-		log.Println("All pings completed, closing results channel")
-		close(results)
-	}()
+	countersBefore, countersErr := readInterfaceCounters()
+	previous := previousLatencies()
+	if stale != nil {
+		// The restored run is the last run, so it has no trend of its own.
+		previous = nil
+	}
+	baseline := baselineLatencies()
+	var firstResult, lastResult time.Duration
+	completed := make([]PingResult, 0, len(regions))
+	// The leader follows the run to the end even if its client goes away,
+	// so the run it records is complete.
+	done := r.Context().Done()
+	if leader {
+		done = nil
+	}
+	for i := 0; ; i++ {
+		result, ok := run.next(i, done)
+		if !ok {
+			break
+		}
+		applyClientTiming()
+		result.ClientPing = clientPing
+		result.ClientPacketLoss = clientPacketLoss
+		result.ClientOutboundMs = clientOutbound
+		result.ClientInboundMs = clientInbound
+		result.ClientIPType = clientIPType
+		applyBudget(&result, budget)
 
-	for result := range results {
-		data, err := json.Marshal(result)
+		now := time.Now()
+		if firstResult == 0 {
+			firstResult = now.Sub(startedAt)
+		}
+		lastResult = now.Sub(startedAt)
+		// Restored results keep the time they were originally sent.
+		if stale == nil || result.Timestamp == "" {
+			result.Timestamp = now.UTC().Format(time.RFC3339Nano)
+		}
+		// Only direct results are recorded, so history and integrations see
+		// one result per region.
+		if result.SourceTag != sourceTagVPN {
+			setTrend(&result, previous)
+			setBaselineDelta(&result, baseline)
+			completed = append(completed, result)
+		}
+		var payload interface{} = result
+		if fields != nil {
+			payload = filterFields(result, fields)
+		}
+		data, err := json.Marshal(payload)
 		if err != nil {
 			log.Printf("Error marshaling result: %v", err)
 			continue
@@ -201,18 +1201,259 @@ func streamHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Sent result for region %s", result.Code)
 	}
 
+	applyClientTiming()
+	completedAt := time.Now()
+	// Only the stream that started the run records it. This happens before
+	// run_complete so that clients fetching /api/slo or /api/snapshot on that
+	// event see this run.
+	if leader {
+		if change := finishRun(completed); change != nil {
+			writeSSEEvent(w, flusher, "server_location_changed", change)
+		}
+	}
+	complete := RunCompleteEvent{
+		CompletedAt:   completedAt.UTC().Format(time.RFC3339),
+		DurationMs:    completedAt.Sub(startedAt).Milliseconds(),
+		FirstResultMs: firstResult.Milliseconds(),
+		LastResultMs:  lastResult.Milliseconds(),
+	}
+	if countersErr == nil {
+		if countersAfter, err := readInterfaceCounters(); err == nil {
+			complete.RunBytesSent = countersAfter.sent - countersBefore.sent
+			complete.RunBytesReceived = countersAfter.received - countersBefore.received
+		} else {
+			log.Printf("Error reading interface counters: %v", err)
+		}
+	} else if countersErr != errNetStatsUnavailable {
+		log.Printf("Error reading interface counters: %v", countersErr)
+	}
+	writeSSEEvent(w, flusher, "run_complete", complete)
+
 	log.Println("Finished streaming all results")
 }
 
+// writeSSEEvent sends v as a named SSE event.
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	flusher.Flush()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	regions := awsping.GetRegions()
-	component := page(regions)
+	regions := getRegions()
+	component := page(regions, PageOptions{
+		ManualStart:    *manualStart,
+		AutoStartDelay: *autoStartDelay,
+		ServerRegion:   serverRegion,
+		VPN:            *vpnIP != "",
+		SpeedTest:      *speedTest,
+		Baseline:       baselineEnabled(),
+		STUNServer:     *stunServer,
+	})
 	component.Render(r.Context(), w)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runRegressionTest(os.Args[2:]))
+	}
+
+	flag.Parse()
+
+	if *bindIP != "" {
+		if err := validateBindIP(*bindIP); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Sourcing pings from %s", *bindIP)
+		icmpSourceIP = *bindIP
+	}
+
+	// VPN mode is quietly disabled when the address isn't bound locally,
+	// e.g. because the VPN is down.
+	if *vpnIP != "" && validateBindIP(*vpnIP) != nil {
+		*vpnIP = ""
+	}
+
+	if region, err := loadEC2Region(); err == nil && region != "" {
+		log.Printf("Running on EC2 in %s", region)
+		serverRegion = region
+	}
+
+	if *ecsMetadata {
+		metadata, err := loadECSMetadata()
+		if err != nil {
+			log.Printf("Error reading ECS task metadata: %v", err)
+		} else {
+			log.Printf("ECS task %s in cluster %s, VPC %s", metadata.TaskARN, metadata.Cluster, metadata.VPCID)
+			// An explicit --bind-ip wins over the discovered task IP.
+			if ip, subnet, ok := metadata.containerIP(); ok && *bindIP != "" {
+				log.Printf("ECS task IP %s in subnet %s; sourcing ICMP pings from --bind-ip %s instead", ip, subnet, *bindIP)
+			} else if ok {
+				log.Printf("ECS task IP %s in subnet %s; sourcing ICMP pings from it", ip, subnet)
+				icmpSourceIP = ip
+			} else {
+				log.Println("ECS task metadata lists no IPv4 address")
+			}
+		}
+	}
+
+	initDoH()
+
+	if *geoFenceBaselineFile != "" {
+		if err := loadGeoFenceBaseline(); err != nil {
+			log.Fatalf("Error loading geo-fence baseline: %v", err)
+		}
+	}
+
+	if *baselineFile != "" {
+		if err := loadBaseline(); err != nil {
+			log.Fatalf("Error loading baseline: %v", err)
+		}
+	}
+
+	if *cacheFile != "" {
+		if err := loadResultCache(); err != nil {
+			log.Printf("Error loading result cache, starting without it: %v", err)
+		}
+	}
+
+	if *loadTestIPs != "" {
+		ips, err := parseLoadTestIPs(*loadTestIPs)
+		if err != nil {
+			log.Fatalf("Error in --load-test-ips: %v", err)
+		}
+		if *loadTestCycles <= 0 {
+			log.Fatal("--load-test-cycles must be positive")
+		}
+		loadTestSources = ips
+	}
+
+	if *connectTimeoutMs <= 0 || *responseTimeoutMs <= 0 {
+		log.Fatal("--connect-timeout-ms and --response-timeout-ms must be positive")
+	}
+	if *dnsResolvers != "" {
+		var err error
+		resolverIPs, err = parseResolvers(*dnsResolvers)
+		if err != nil {
+			log.Fatalf("Error in --dns-resolvers: %v", err)
+		}
+	}
+	if *maxConcurrentRuns < 1 {
+		log.Fatal("--max-concurrent-runs must be at least 1")
+	}
+	if *keepAliveIntervalMs <= 0 && !*keepAliveDisable {
+		log.Fatal("--keepalive-interval-ms must be positive; use --keepalive-disable to turn keep-alive off")
+	}
+
+	if *replayFile != "" {
+		if *replaySpeed < 0.1 || *replaySpeed > 10 {
+			log.Fatal("--replay-speed must be between 0.1 and 10")
+		}
+		results, err := loadReplay(*replayFile)
+		if err != nil {
+			log.Fatalf("Error loading replay file: %v", err)
+		}
+		replayedResults = results
+		log.Printf("Replaying %d recorded results at %gx", len(results), *replaySpeed)
+	}
+
+	if *speedTest && *speedTestObject == "" {
+		log.Fatal("--speed-test needs --speed-test-object")
+	}
+
+	if err := initIPClassifier(); err != nil {
+		log.Fatalf("Error loading client IP CIDR lists: %v", err)
+	}
+
+	if *egressPricingURL != "" {
+		if !*speedTest {
+			log.Fatal("--egress-pricing-url needs --speed-test")
+		}
+		go func() {
+			if err := loadEgressPricing(); err != nil {
+				log.Printf("Error loading egress pricing: %v", err)
+			}
+		}()
+	}
+
+	if *checkDeprecated {
+		go func() {
+			if err := loadPublishedRegions(); err != nil {
+				log.Printf("Error loading published AWS regions: %v", err)
+			}
+		}()
+	}
+
+	if *consulAddr != "" && *consulService != "" {
+		startConsulDiscovery()
+	}
+
+	if *cliMode {
+		os.Exit(runCLI())
+	}
+
+	if *fleetURLs != "" {
+		agents, err := loadFleetURLs(*fleetURLs)
+		if err != nil {
+			log.Fatalf("Error reading --fleet-urls: %v", err)
+		}
+		log.Printf("Loaded %d fleet agents", len(agents))
+		fleetAgents = agents
+	}
+
+	if *smtpHost != "" {
+		if err := validateSMTPFlags(); err != nil {
+			log.Fatalf("Error in SMTP settings: %v", err)
+		}
+		schedule, err := parseCron(*reportSchedule)
+		if err != nil {
+			log.Fatalf("Invalid --report-schedule %q: %v", *reportSchedule, err)
+		}
+		startScheduledReports(schedule)
+	}
+
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/ping", streamHandler)
+	http.HandleFunc("/api/report.html", reportHandler)
+	http.HandleFunc("/api/simulate", simulateHandler)
+	http.HandleFunc("/api/snapshot", snapshotHandler)
+	http.HandleFunc("/api/fleet", fleetHandler)
+	http.HandleFunc("/api/anomalies", anomaliesHandler)
+	http.HandleFunc("/api/matrix", matrixHandler)
+	http.HandleFunc("/api/best-region", bestRegionHandler)
+	http.HandleFunc("/api/compare", compareHandler)
+	http.HandleFunc("/api/budget-allocation", budgetAllocationHandler)
+	http.HandleFunc("/api/services", servicesHandler)
+	http.HandleFunc("/api/slo", sloHandler)
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/api/client-timing", clientTimingHandler)
+	http.HandleFunc("/api/best-per-continent", bestPerContinentHandler)
+	http.HandleFunc("/api/protocol-comparison", protocolComparisonHandler)
+	http.HandleFunc("/api/history/sparkline", sparklineHandler)
+	http.HandleFunc("/api/config/validate", configValidateHandler)
+	http.HandleFunc("/api/load-test", loadTestHandler)
+	http.HandleFunc("/api/ping/aggregate", aggregateHandler)
+	http.HandleFunc("/api/firewall-check", firewallCheckHandler)
+	http.HandleFunc("/api/keepalive-benchmark", keepAliveBenchmarkHandler)
+	http.HandleFunc("/version", versionHandler)
+	http.HandleFunc("/traceroute", traceroutePageHandler)
+	http.HandleFunc("/traceroute/{region_code}", tracerouteHandler)
+	http.HandleFunc("/api/import", importHandler)
+	http.HandleFunc("/runs/{run_id}", importedRunHandler)
+	http.HandleFunc("/rtc/offer", rtcHandler(false))
+	http.HandleFunc("/rtc/answer", rtcHandler(true))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type MatrixAgent struct {
+	URL string `json:"url"`
+	// Region is the agent's own region, taken to be the one it pings fastest.
+	Region string `json:"region,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type MatrixResponse struct {
+	Agents []MatrixAgent `json:"agents"`
+	// Matrix[i][j] is the round trip between the regions of agents i and j,
+	// averaged over both directions, or null when neither agent measured it.
+	Matrix [][]*float64 `json:"matrix"`
+}
+
+// agentRegion returns the code of the fastest successful result, which for
+// an agent running inside AWS is the region it is deployed in.
+func agentRegion(results []PingResult) string {
+	var code string
+	var fastest float64
+	for _, result := range results {
+		if result.Error == "" && (code == "" || result.Latency < fastest) {
+			code, fastest = result.Code, result.Latency
+		}
+	}
+	return code
+}
+
+// unknownAgents returns the URLs that aren't fleet agents.
+func unknownAgents(urls []string) []string {
+	var unknown []string
+	for _, url := range urls {
+		if !slices.Contains(fleetAgents, strings.TrimSuffix(url, "/")) {
+			unknown = append(unknown, url)
+		}
+	}
+	return unknown
+}
+
+func matrixHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST with a JSON array of agent URLs"})
+		return
+	}
+	var urls []string
+	if err := json.NewDecoder(r.Body).Decode(&urls); err != nil || len(urls) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be a non-empty JSON array of agent URLs"})
+		return
+	}
+	// Only agents from --fleet-urls are fetched, so the endpoint can't be
+	// used to make the server request arbitrary URLs.
+	if unknown := unknownAgents(urls); len(unknown) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "agents must be listed in --fleet-urls", "agents": unknown})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), *fleetTimeout)
+	defer cancel()
+
+	agents := make([]MatrixAgent, len(urls))
+	latencies := make([]map[string]float64, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			agents[i].URL = url
+			results, err := fetchSnapshot(ctx, strings.TrimSuffix(url, "/"))
+			if err != nil {
+				agents[i].Error = err.Error()
+				return
+			}
+			agents[i].Region = agentRegion(results)
+			latencies[i] = make(map[string]float64, len(results))
+			for _, result := range results {
+				if result.Error == "" {
+					latencies[i][result.Code] = result.Latency
+				}
+			}
+		}(i, url)
+	}
+	wg.Wait()
+
+	matrix := make([][]*float64, len(agents))
+	for i := range agents {
+		matrix[i] = make([]*float64, len(agents))
+		for j := range agents {
+			forward, okForward := latencies[i][agents[j].Region]
+			reverse, okReverse := latencies[j][agents[i].Region]
+			var value float64
+			switch {
+			case okForward && okReverse:
+				value = (forward + reverse) / 2
+			case okForward:
+				value = forward
+			case okReverse:
+				value = reverse
+			default:
+				continue
+			}
+			matrix[i][j] = &value
+		}
+	}
+
+	writeJSON(w, http.StatusOK, MatrixResponse{Agents: agents, Matrix: matrix})
+}
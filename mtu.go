@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+var mtuDetect = flag.Bool("mtu-detect", false, "find each region's path MTU with don't-fragment ICMP echoes (sends about a dozen packets per region)")
+
+const (
+	// icmpEchoOverhead is the IPv4 and ICMP header bytes around an echo's
+	// payload.
+	icmpEchoOverhead = 28
+	// maxMTUPayload fills a 1500-byte Ethernet MTU.
+	maxMTUPayload = 1500 - icmpEchoOverhead
+	// minMTUPayload fills the 576 bytes every IPv4 host must accept, so a
+	// host that doesn't answer it doesn't answer ICMP at all.
+	minMTUPayload = 576 - icmpEchoOverhead
+	// lowPathMTU is the path MTU below which a region is flagged.
+	lowPathMTU = 1400
+	// mtuProbeTimeout is how long each probe waits for its reply. Probes
+	// that are too big are usually dropped silently, so this bounds the
+	// whole search.
+	mtuProbeTimeout = time.Second
+)
+
+// errMTUUnavailable is returned where the don't-fragment bit can't be set on
+// ICMP sockets.
+var errMTUUnavailable = errors.New("path MTU detection is only supported on Linux")
+
+// detectMTU binary searches for the largest echo payload that reaches host
+// with the don't-fragment bit set and returns it. The path MTU is the
+// payload plus icmpEchoOverhead. It needs raw ICMP sockets, like the region
+// ICMP ping. The search stops with ctx's error once ctx ends, and no probe
+// waits past ctx's deadline.
+func detectMTU(ctx context.Context, host string) (int, error) {
+	if !icmpAvailable() {
+		return 0, errICMPUnavailable
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return 0, err
+	}
+	dst := addrs[0]
+
+	listenAddr := "0.0.0.0"
+	if icmpSourceIP != "" {
+		listenAddr = icmpSourceIP
+	}
+	conn, err := listenDontFragment(listenAddr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	probe := func(size int) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		deadline := time.Now().Add(mtuProbeTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		return probeMTU(conn, dst, size, deadline)
+	}
+	if ok, err := probe(minMTUPayload); err != nil || !ok {
+		if err == nil {
+			err = fmt.Errorf("no reply from %s to a %d-byte echo", dst, minMTUPayload)
+		}
+		return 0, err
+	}
+	if ok, err := probe(maxMTUPayload); err != nil || ok {
+		return maxMTUPayload, err
+	}
+
+	// low always got through and high never did.
+	low, high := minMTUPayload, maxMTUPayload
+	for high-low > 1 {
+		mid := (low + high) / 2
+		ok, err := probe(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+// probeMTU sends one don't-fragment echo carrying size bytes and reports
+// whether its reply came back. A packet too big for the local interface or
+// answered with "fragmentation needed" counts as not getting through. It
+// waits for the reply until deadline.
+func probeMTU(conn *net.IPConn, dst net.IP, size int, deadline time.Time) (bool, error) {
+	id := os.Getpid() & 0xffff
+	seq := int(icmpRegionSeq.Add(1) & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, size)},
+	}
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return false, err
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return false, err
+	}
+	if _, err := conn.WriteTo(msgBytes, &net.IPAddr{IP: dst}); err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, nil
+			}
+			return false, err
+		}
+		msg, err := icmp.ParseMessage(1, reply[:n])
+		if err != nil {
+			continue
+		}
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if ip, ok := peer.(*net.IPAddr); ok && ip.IP.Equal(dst) && msg.Type == ipv4.ICMPTypeEchoReply && body.ID == id && body.Seq == seq {
+				return true, nil
+			}
+		case *icmp.DstUnreach:
+			// A router's "fragmentation needed" quotes our IP header and
+			// the first 8 bytes of the echo, ID and sequence included.
+			if msg.Code == 4 && quotesEcho(body.Data, id, seq) {
+				return false, nil
+			}
+		}
+	}
+}
+
+// quotesEcho reports whether an ICMP error's quoted datagram is the echo
+// with the given ID and sequence number.
+func quotesEcho(quoted []byte, id, seq int) bool {
+	if len(quoted) < 20 {
+		return false
+	}
+	headerLen := int(quoted[0]&0x0f) * 4
+	if len(quoted) < headerLen+8 {
+		return false
+	}
+	echo := quoted[headerLen:]
+	return int(binary.BigEndian.Uint16(echo[4:6])) == id && int(binary.BigEndian.Uint16(echo[6:8])) == seq
+}
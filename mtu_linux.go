@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenDontFragment opens a raw ICMP socket whose packets carry the
+// don't-fragment bit. IP_PMTUDISC_PROBE sets it without consulting the
+// kernel's path MTU cache, so each probe tests the path afresh.
+func listenDontFragment(addr string) (*net.IPConn, error) {
+	conn, err := net.ListenIP("ip4:icmp", &net.IPAddr{IP: net.ParseIP(addr)})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+	}); err != nil {
+		sockErr = err
+	}
+	if sockErr != nil {
+		conn.Close()
+		return nil, sockErr
+	}
+	return conn, nil
+}
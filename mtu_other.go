@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+func listenDontFragment(addr string) (*net.IPConn, error) {
+	return nil, errMTUUnavailable
+}
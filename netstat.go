@@ -0,0 +1,14 @@
+package main
+
+import "errors"
+
+// interfaceCounters are the byte totals the kernel reports for a network
+// interface since it came up.
+type interfaceCounters struct {
+	sent     int64
+	received int64
+}
+
+// errNetStatsUnavailable is returned where interface byte counters can't be
+// read.
+var errNetStatsUnavailable = errors.New("interface statistics are only supported on Linux")
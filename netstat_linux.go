@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readInterfaceCounters reads /proc/net/dev for the interface carrying the
+// default route. Without one it sums every interface except loopback.
+func readInterfaceCounters() (interfaceCounters, error) {
+	primary := defaultRouteInterface()
+
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return interfaceCounters{}, err
+	}
+	defer f.Close()
+
+	var counters interfaceCounters
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, stats, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue // header lines
+		}
+		name = strings.TrimSpace(name)
+		if primary != "" && name != primary || primary == "" && name == "lo" {
+			continue
+		}
+		// Receive bytes is the first field and transmit bytes the ninth.
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			return interfaceCounters{}, fmt.Errorf("unexpected /proc/net/dev line for %s", name)
+		}
+		received, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return interfaceCounters{}, err
+		}
+		sent, err := strconv.ParseInt(fields[8], 10, 64)
+		if err != nil {
+			return interfaceCounters{}, err
+		}
+		counters.received += received
+		counters.sent += sent
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return interfaceCounters{}, err
+	}
+	if !found {
+		return interfaceCounters{}, fmt.Errorf("no matching interface in /proc/net/dev")
+	}
+	return counters, nil
+}
+
+// defaultRouteInterface returns the interface of the IPv4 default route in
+// /proc/net/route, or "" if there is none.
+func defaultRouteInterface() string {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[1] == "00000000" {
+			return fields[0]
+		}
+	}
+	return ""
+}
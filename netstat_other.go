@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func readInterfaceCounters() (interfaceCounters, error) {
+	return interfaceCounters{}, errNetStatsUnavailable
+}
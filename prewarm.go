@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var prewarm = flag.Bool("prewarm", false, "open and close a TLS connection to each region before measuring it")
+
+// prewarmRegion completes a TCP and TLS handshake with the region's S3
+// endpoint and closes the connection straight away, so the measured pings
+// that follow see warm DNS and routing caches. Plain HTTP targets only get
+// the TCP handshake. It returns how long the handshake took.
+func prewarmRegion(ctx context.Context, region awsping.AWSRegion) (time.Duration, error) {
+	u, err := url.Parse(endpointURL(region))
+	if err != nil {
+		return 0, err
+	}
+
+	netDialer := &net.Dialer{Timeout: connectTimeout()}
+	if *bindIP != "" {
+		netDialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(*bindIP)}
+	}
+	var dialer interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	} = &tls.Dialer{NetDialer: netDialer}
+	port := "443"
+	if u.Scheme == "http" {
+		dialer, port = netDialer, "80"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return elapsed, nil
+}
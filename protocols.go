@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+// protocolComparisonConcurrency caps the regions measured at once by
+// /api/protocol-comparison; each one keeps two protocols' pings in flight.
+const protocolComparisonConcurrency = 4
+
+// http1Client is the ping client with HTTP/2 negotiation turned off.
+var http1Client = sync.OnceValue(func() *http.Client {
+	client := newPingClient(*bindIP)
+	transport := client.Transport.(*http.Transport)
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	// The cloned default transport may already advertise h2 over ALPN.
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	return client
+})
+
+// ProtocolComparison holds each protocol's fastest ping to a region. A nil
+// latency means the protocol could not be measured: the endpoint didn't
+// negotiate it, every attempt failed or, for HTTP/3, no QUIC client is built
+// in.
+type ProtocolComparison struct {
+	Code    string   `json:"code"`
+	HTTP1Ms *float64 `json:"http1_ms"`
+	HTTP2Ms *float64 `json:"http2_ms"`
+	HTTP3Ms *float64 `json:"http3_ms"`
+	// Recommendation is the protocol with the lowest measured latency, or
+	// empty if none was measured.
+	Recommendation string `json:"recommendation"`
+}
+
+// fastestWithProtocol returns the fastest of pingAttempts pings that were
+// answered over the given HTTP major version.
+func fastestWithProtocol(ctx context.Context, client *http.Client, region awsping.AWSRegion, protoMajor int) *float64 {
+	var fastest time.Duration
+	for i := 0; i < pingAttempts; i++ {
+		sample, err := pingRegion(ctx, client, region, "", nil)
+		if err != nil || sample.resp.ProtoMajor != protoMajor {
+			continue
+		}
+		if fastest == 0 || sample.latency < fastest {
+			fastest = sample.latency
+		}
+	}
+	if fastest == 0 {
+		return nil
+	}
+	ms := float64(fastest) / float64(time.Millisecond)
+	return &ms
+}
+
+func compareProtocols(ctx context.Context, region awsping.AWSRegion) ProtocolComparison {
+	comparison := ProtocolComparison{Code: region.Code}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		comparison.HTTP1Ms = fastestWithProtocol(ctx, http1Client(), region, 1)
+	}()
+	go func() {
+		defer wg.Done()
+		comparison.HTTP2Ms = fastestWithProtocol(ctx, pingHTTPClient(), region, 2)
+	}()
+	wg.Wait()
+
+	best := 0.0
+	for _, candidate := range []struct {
+		name    string
+		latency *float64
+	}{{"http1", comparison.HTTP1Ms}, {"http2", comparison.HTTP2Ms}, {"http3", comparison.HTTP3Ms}} {
+		if candidate.latency != nil && (comparison.Recommendation == "" || *candidate.latency < best) {
+			comparison.Recommendation = candidate.name
+			best = *candidate.latency
+		}
+	}
+	return comparison
+}
+
+// protocolComparisonHandler pings every region over HTTP/1.1 and HTTP/2.
+// HTTP/3 is always reported as unmeasured, as no QUIC client is vendored.
+func protocolComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	if !acquireRunSlot(r.Context(), func(int) {}) {
+		return
+	}
+	defer releaseRunSlot()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, protocolComparisonConcurrency)
+	comparisons := []ProtocolComparison{}
+	for _, region := range getRegions() {
+		if strings.HasPrefix(region.Code, consulCodePrefix) {
+			continue
+		}
+		wg.Add(1)
+		go func(region awsping.AWSRegion) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// The deadline starts once the region gets a slot, so regions
+			// queued behind slow ones still get their full time.
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(float64(responseTimeout()*pingAttempts)*1.1))
+			defer cancel()
+			comparison := compareProtocols(ctx, region)
+			mu.Lock()
+			comparisons = append(comparisons, comparison)
+			mu.Unlock()
+		}(region)
+	}
+	wg.Wait()
+
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].Code < comparisons[j].Code
+	})
+	writeJSON(w, http.StatusOK, comparisons)
+}
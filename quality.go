@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qualityThreshold is the most a region may show of each measure to earn a
+// tier. Loss must be strictly below maxLossPct, except that a maximum of 0
+// means no loss at all.
+type qualityThreshold struct {
+	tier       string
+	maxLatency float64
+	maxJitter  float64
+	maxLossPct float64
+}
+
+// qualityTiers are checked in order; a region that meets none is "Poor".
+var qualityTiers = qualityTierList{
+	{tier: "Excellent", maxLatency: 50, maxJitter: 5, maxLossPct: 0},
+	{tier: "Good", maxLatency: 100, maxJitter: 20, maxLossPct: 1},
+	{tier: "Fair", maxLatency: 200, maxJitter: 50, maxLossPct: 5},
+}
+
+func init() {
+	flag.Var(&qualityTiers, "quality-tier", "override a quality tier's limits as <Excellent|Good|Fair>:<latency_ms>:<jitter_ms>:<loss_pct> (repeatable)")
+}
+
+// qualityTierList is a flag.Value that overrides the limits of the named
+// tiers, leaving the others at their defaults.
+type qualityTierList []qualityThreshold
+
+func (l *qualityTierList) String() string {
+	parts := make([]string, len(*l))
+	for i, t := range *l {
+		parts[i] = fmt.Sprintf("%s:%g:%g:%g", t.tier, t.maxLatency, t.maxJitter, t.maxLossPct)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *qualityTierList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return fmt.Errorf("expected <tier>:<latency_ms>:<jitter_ms>:<loss_pct>, got %q", value)
+	}
+	var limits [3]float64
+	for i, part := range parts[1:] {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid limit %q", part)
+		}
+		limits[i] = v
+	}
+	for i := range *l {
+		if strings.EqualFold((*l)[i].tier, parts[0]) {
+			(*l)[i].maxLatency, (*l)[i].maxJitter, (*l)[i].maxLossPct = limits[0], limits[1], limits[2]
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tier %q; expected Excellent, Good or Fair", parts[0])
+}
+
+// qualityTier labels a region's connection from its latency, jitter and
+// packet loss, so the table reads without interpreting raw numbers.
+func qualityTier(latency, jitter, packetLoss float64) string {
+	for _, t := range qualityTiers {
+		lossOK := packetLoss < t.maxLossPct || t.maxLossPct == 0 && packetLoss == 0
+		if latency < t.maxLatency && jitter < t.maxJitter && lossOK {
+			return t.tier
+		}
+	}
+	return "Poor"
+}
+
+// jitterMs is the mean absolute difference between consecutive successful
+// attempts, as in RFC 3550's interarrival jitter without the smoothing.
+func jitterMs(samples []time.Duration) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	var total float64
+	for i := 1; i < len(samples); i++ {
+		total += math.Abs(float64(samples[i]-samples[i-1])) / float64(time.Millisecond)
+	}
+	return total / float64(len(samples)-1)
+}
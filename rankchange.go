@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	rankChangeWebhook   = flag.String("rank-change-webhook", "", "URL to POST to when a region's latency rank changes significantly")
+	rankChangeThreshold = flag.Int("rank-change-threshold", 5, "number of positions a region must move to trigger the rank change webhook")
+)
+
+type RankChange struct {
+	RegionCode   string  `json:"region_code"`
+	OldRank      int     `json:"old_rank"`
+	NewRank      int     `json:"new_rank"`
+	OldLatencyMs float64 `json:"old_latency_ms"`
+	NewLatencyMs float64 `json:"new_latency_ms"`
+}
+
+type rankEntry struct {
+	rank    int
+	latency float64
+}
+
+// previousRanks holds the ranking from the last completed run.
+var previousRanks struct {
+	sync.Mutex
+	ranks map[string]rankEntry
+}
+
+// rankResults orders the successful results by latency, fastest first, and
+// returns each region's 1-based rank.
+func rankResults(results []PingResult) map[string]rankEntry {
+	ok := make([]PingResult, 0, len(results))
+	for _, result := range results {
+		if result.Error == "" {
+			ok = append(ok, result)
+		}
+	}
+	sort.Slice(ok, func(i, j int) bool {
+		return ok[i].Latency < ok[j].Latency
+	})
+
+	ranks := make(map[string]rankEntry, len(ok))
+	for i, result := range ok {
+		ranks[result.Code] = rankEntry{rank: i + 1, latency: result.Latency}
+	}
+	return ranks
+}
+
+// checkRankChanges compares the ranking of a completed run with the previous
+// one and notifies the rank change webhook about regions that moved further
+// than the configured threshold.
+func checkRankChanges(results []PingResult) {
+	ranks := rankResults(results)
+
+	previousRanks.Lock()
+	old := previousRanks.ranks
+	previousRanks.ranks = ranks
+	previousRanks.Unlock()
+
+	if old == nil {
+		return
+	}
+
+	for code, current := range ranks {
+		prev, ok := old[code]
+		if !ok {
+			continue
+		}
+		moved := current.rank - prev.rank
+		if moved < 0 {
+			moved = -moved
+		}
+		if moved <= *rankChangeThreshold {
+			continue
+		}
+
+		change := RankChange{
+			RegionCode:   code,
+			OldRank:      prev.rank,
+			NewRank:      current.rank,
+			OldLatencyMs: prev.latency,
+			NewLatencyMs: current.latency,
+		}
+		log.Printf("Region %s moved from rank %d to %d", code, prev.rank, current.rank)
+		if err := postRankChange(change); err != nil {
+			log.Printf("Error posting rank change for %s: %v", code, err)
+		}
+	}
+}
+
+func postRankChange(change RankChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	resp, err := client.Post(*rankChangeWebhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	log.Printf("Rank change webhook for %s returned %s", change.RegionCode, resp.Status)
+	return nil
+}
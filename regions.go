@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/ekalinin/awsping"
+)
+
+var (
+	chinaRegions    = flag.Bool("china-regions", false, "also ping the AWS China regions")
+	govCloudRegions = flag.Bool("govcloud-regions", false, "also ping the AWS GovCloud (US) regions")
+)
+
+// China and GovCloud regions live in separate AWS partitions and are not part
+// of awsping.GetRegions(); they are only pinged when enabled by flag.
+var (
+	chinaRegionList = []awsping.AWSRegion{
+		awsping.NewRegion("China (Beijing)", "cn-north-1"),
+		awsping.NewRegion("China (Ningxia)", "cn-northwest-1"),
+	}
+	govCloudRegionList = []awsping.AWSRegion{
+		awsping.NewRegion("AWS GovCloud (US-West)", "us-gov-west-1"),
+		awsping.NewRegion("AWS GovCloud (US-East)", "us-gov-east-1"),
+	}
+)
+
+// getRegions returns the regions to ping: the standard awsping list plus any
+// extra partitions enabled on the command line, followed by Consul targets.
+func getRegions() []awsping.AWSRegion {
+	regions := awsping.GetRegions()
+	if *chinaRegions {
+		regions = append(regions, chinaRegionList...)
+	}
+	if *govCloudRegions {
+		regions = append(regions, govCloudRegionList...)
+	}
+	return append(regions, consulRegions()...)
+}
+
+// endpointURL returns the base S3 URL for a region. The China partition uses
+// the amazonaws.com.cn domain; GovCloud's regional endpoints are on
+// amazonaws.com like the commercial ones. Consul targets are pinged on their
+// discovered health URL instead.
+func endpointURL(region awsping.AWSRegion) string {
+	if endpoint, ok := consulEndpoint(region.Code); ok {
+		return endpoint
+	}
+	if strings.HasPrefix(region.Code, "cn-") {
+		return "https://s3." + region.Code + ".amazonaws.com.cn/"
+	}
+	return "https://s3." + region.Code + ".amazonaws.com/"
+}
+
+// regionLocation is the approximate location of an AWS region's data centres.
+type regionLocation struct {
+	Lat float64
+	Lon float64
+}
+
+// regionLocations maps region codes to the city each region is named after.
+var regionLocations = map[string]regionLocation{
+	"us-east-1":      {Lat: 38.13, Lon: -78.45},  // N. Virginia
+	"us-east-2":      {Lat: 39.96, Lon: -83.00},  // Ohio
+	"us-west-1":      {Lat: 37.35, Lon: -121.96}, // N. California
+	"us-west-2":      {Lat: 46.15, Lon: -123.88}, // Oregon
+	"ca-central-1":   {Lat: 45.50, Lon: -73.57},  // Montreal
+	"eu-west-1":      {Lat: 53.35, Lon: -6.26},   // Dublin
+	"eu-central-1":   {Lat: 50.11, Lon: 8.68},    // Frankfurt
+	"eu-west-2":      {Lat: 51.51, Lon: -0.13},   // London
+	"eu-south-1":     {Lat: 45.46, Lon: 9.19},    // Milan
+	"eu-west-3":      {Lat: 48.86, Lon: 2.35},    // Paris
+	"eu-north-1":     {Lat: 59.33, Lon: 18.07},   // Stockholm
+	"af-south-1":     {Lat: -33.92, Lon: 18.42},  // Cape Town
+	"ap-northeast-3": {Lat: 34.69, Lon: 135.50},  // Osaka
+	"ap-east-1":      {Lat: 22.32, Lon: 114.17},  // Hong Kong
+	"ap-northeast-1": {Lat: 35.68, Lon: 139.69},  // Tokyo
+	"ap-northeast-2": {Lat: 37.57, Lon: 126.98},  // Seoul
+	"ap-southeast-1": {Lat: 1.35, Lon: 103.82},   // Singapore
+	"ap-south-1":     {Lat: 19.08, Lon: 72.88},   // Mumbai
+	"ap-southeast-2": {Lat: -33.87, Lon: 151.21}, // Sydney
+	"sa-east-1":      {Lat: -23.55, Lon: -46.63}, // São Paulo
+	"me-south-1":     {Lat: 26.07, Lon: 50.56},   // Bahrain
+	"cn-north-1":     {Lat: 39.90, Lon: 116.40},  // Beijing
+	"cn-northwest-1": {Lat: 37.50, Lon: 105.19},  // Ningxia
+	"us-gov-west-1":  {Lat: 45.60, Lon: -121.18}, // Oregon
+	"us-gov-east-1":  {Lat: 39.96, Lon: -83.00},  // Ohio
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Exit codes of the test subcommand.
+const (
+	regressionPass      = 0
+	regressionFail      = 1
+	regressionInfraFail = 2
+)
+
+// runRegressionTest implements "aws-ping test": it pings every region once
+// and compares the latencies with a golden file, which holds a JSON array of
+// PingResults as saved by --update-golden or served by /api/snapshot. It
+// returns the process exit code.
+func runRegressionTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	golden := fs.String("golden", "golden.json", "golden results file")
+	tolerance := fs.Float64("tolerance", 0.15, "allowed latency increase over the golden value, as a fraction")
+	updateGolden := fs.Bool("update-golden", false, "save this run as the new golden results instead of comparing")
+	if err := fs.Parse(args); err != nil {
+		return regressionInfraFail
+	}
+	if *tolerance < 0 {
+		fmt.Fprintln(os.Stderr, "--tolerance must not be negative")
+		return regressionInfraFail
+	}
+
+	var goldenResults []PingResult
+	if !*updateGolden {
+		data, err := os.ReadFile(*golden)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading golden results: %v\n", err)
+			return regressionInfraFail
+		}
+		if err := json.Unmarshal(data, &goldenResults); err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding golden results %s: %v\n", *golden, err)
+			return regressionInfraFail
+		}
+	}
+
+	var current []PingResult
+	succeeded := 0
+	for result := range runPings(context.Background(), getRegions(), runOptions{}) {
+		current = append(current, result)
+		if result.Error == "" {
+			succeeded++
+		}
+	}
+	// Every region failing points at this machine's network, not latency.
+	if succeeded == 0 {
+		fmt.Fprintln(os.Stderr, "Every region failed to ping")
+		return regressionInfraFail
+	}
+
+	if *updateGolden {
+		sort.Slice(current, func(i, j int) bool { return current[i].Code < current[j].Code })
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding golden results: %v\n", err)
+			return regressionInfraFail
+		}
+		if err := os.WriteFile(*golden, append(data, '\n'), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing golden results: %v\n", err)
+			return regressionInfraFail
+		}
+		fmt.Printf("Saved %d results to %s\n", len(current), *golden)
+		return regressionPass
+	}
+
+	byCode := make(map[string]PingResult, len(current))
+	for _, result := range current {
+		byCode[result.Code] = result
+	}
+	sort.Slice(goldenResults, func(i, j int) bool { return goldenResults[i].Code < goldenResults[j].Code })
+
+	status := regressionPass
+	fmt.Printf("%-16s %10s %10s %10s  %s\n", "REGION", "GOLDEN", "CURRENT", "LIMIT", "RESULT")
+	for _, want := range goldenResults {
+		// A region that was already failing has no latency to regress from.
+		if want.Error != "" {
+			continue
+		}
+		limit := want.Latency * (1 + *tolerance)
+		got, found := byCode[want.Code]
+		var currentCol, verdict string
+		switch {
+		case !found:
+			currentCol, verdict = "-", "FAIL (not pinged)"
+		case got.Error != "":
+			currentCol, verdict = "-", "FAIL ("+got.ErrorType+")"
+		case got.Latency > limit:
+			currentCol, verdict = fmt.Sprintf("%.2f", got.Latency), "FAIL"
+		default:
+			currentCol, verdict = fmt.Sprintf("%.2f", got.Latency), "ok"
+		}
+		if verdict != "ok" {
+			status = regressionFail
+		}
+		fmt.Printf("%-16s %10.2f %10s %10.2f  %s\n", want.Code, want.Latency, currentCol, limit, verdict)
+	}
+	return status
+}
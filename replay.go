@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	replayFile  = flag.String("replay", "", "JSONL file of recorded PingResults to stream instead of running real pings")
+	replaySpeed = flag.Float64("replay-speed", 1.0, "playback speed of --replay, from 0.1 to 10")
+)
+
+// replayedResults holds the results loaded from --replay.
+var replayedResults []PingResult
+
+// loadReplay reads one PingResult per line, skipping blank lines.
+func loadReplay(path string) ([]PingResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []PingResult
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var result PingResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// replayResults streams recorded results, waiting between them for the gap
+// between their original timestamps divided by speed. Results without a
+// parseable timestamp are sent straight after the previous one.
+func replayResults(ctx context.Context, recorded []PingResult, speed float64) <-chan PingResult {
+	results := make(chan PingResult)
+	go func() {
+		defer close(results)
+		var previous time.Time
+		for _, result := range recorded {
+			sent, err := time.Parse(time.RFC3339Nano, result.Timestamp)
+			if err == nil && !previous.IsZero() && sent.After(previous) {
+				select {
+				case <-time.After(time.Duration(float64(sent.Sub(previous)) / speed)):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == nil {
+				previous = sent
+			}
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// reportTemplate renders a self-contained page: all styles, scripts and data
+// are inlined so the saved file works without the server.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AWS Region Ping Report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 1200px; margin: 0 auto; padding: 20px; background: #f5f5f5; }
+.meta { color: #666; margin-bottom: 20px; }
+table { width: 100%; border-collapse: collapse; background: white; box-shadow: 0 1px 3px rgba(0,0,0,0.1); border-radius: 4px; }
+th, td { padding: 12px; text-align: left; border-bottom: 1px solid #eee; }
+th { background: #f8f9fa; font-weight: 600; cursor: pointer; user-select: none; }
+.latency { font-family: monospace; font-size: 14px; }
+.error { color: #dc3545; }
+</style>
+</head>
+<body>
+<h1>AWS Region Ping Report</h1>
+{{if .Name}}<h2>{{.Name}}</h2>
+{{end}}<div class="meta">Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}} from a run completed {{.CompletedAt.Format "2006-01-02 15:04:05 MST"}}. Click a column header to sort.</div>
+<table id="results">
+<thead>
+<tr><th data-key="region">Region</th><th data-key="code">Code</th><th data-key="latency">Latency</th><th data-key="error">Status</th></tr>
+</thead>
+<tbody>
+{{range .Results}}<tr><td>{{.Region}}</td><td>{{.Code}}</td>{{if .Error}}<td class="latency">N/A</td><td class="error">{{.Error}}</td>{{else}}<td class="latency">{{printf "%.2f" .Latency}} ms</td><td>OK</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+<script>
+const results = {{.Results}};
+const tbody = document.querySelector('#results tbody');
+let sortKey = 'latency';
+let ascending = true;
+
+function render() {
+    const rows = results.slice().sort((a, b) => {
+        const x = a[sortKey] || '';
+        const y = b[sortKey] || '';
+        if (x < y) return ascending ? -1 : 1;
+        if (x > y) return ascending ? 1 : -1;
+        return 0;
+    });
+    tbody.innerHTML = '';
+    for (const result of rows) {
+        const tr = document.createElement('tr');
+        const cells = [result.region, result.code,
+            result.error ? 'N/A' : result.latency.toFixed(2) + ' ms',
+            result.error ? result.error : 'OK'];
+        cells.forEach((text, i) => {
+            const td = document.createElement('td');
+            td.textContent = text;
+            if (i === 2) td.className = 'latency';
+            if (i === 3 && result.error) td.className = 'error';
+            tr.appendChild(td);
+        });
+        tbody.appendChild(tr);
+    }
+}
+
+document.querySelectorAll('#results th').forEach((th) => {
+    th.addEventListener('click', () => {
+        const key = th.dataset.key;
+        ascending = key === sortKey ? !ascending : true;
+        sortKey = key;
+        render();
+    });
+});
+</script>
+</body>
+</html>
+`))
+
+type reportData struct {
+	Name        string
+	GeneratedAt time.Time
+	CompletedAt time.Time
+	Results     []PingResult
+}
+
+// renderReport writes the standalone report for a run, successes first and
+// then ordered by latency.
+func renderReport(w io.Writer, results []PingResult, completedAt time.Time) error {
+	return renderNamedReport(w, "", results, completedAt)
+}
+
+// renderNamedReport is renderReport with a heading naming the run.
+func renderNamedReport(w io.Writer, name string, results []PingResult, completedAt time.Time) error {
+	sorted := make([]PingResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if (sorted[i].Error == "") != (sorted[j].Error == "") {
+			return sorted[i].Error == ""
+		}
+		return sorted[i].Latency < sorted[j].Latency
+	})
+
+	return reportTemplate.Execute(w, reportData{
+		Name:        name,
+		GeneratedAt: time.Now(),
+		CompletedAt: completedAt,
+		Results:     sorted,
+	})
+}
+
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	results, completedAt, ok := getLastRun()
+	if !ok {
+		http.Error(w, "No completed ping run yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="aws-ping-report.html"`)
+	if err := renderReport(w, results, completedAt); err != nil {
+		log.Printf("Error rendering report: %v", err)
+	}
+}
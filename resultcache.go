@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var cacheFile = flag.String("cache-file", "", "JSON file the last completed run is saved to and restored from across restarts")
+
+// staleCache holds the run restored from --cache-file until the first /ping
+// stream has been sent it.
+var staleCache struct {
+	sync.Mutex
+	results     []PingResult
+	completedAt time.Time
+}
+
+// saveResultCache writes results to --cache-file through a temporary file
+// and a rename, so a crash mid-write never leaves a truncated cache. Each
+// save has its own temporary file, so concurrent runs finishing at once
+// can't interleave their writes.
+func saveResultCache(results []PingResult) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(*cacheFile), filepath.Base(*cacheFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private; the cache is as readable as before.
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), *cacheFile)
+}
+
+// loadResultCache restores the run saved in --cache-file as the last run,
+// dated by the file's modification time. A missing file is not an error.
+func loadResultCache() error {
+	data, err := os.ReadFile(*cacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(*cacheFile)
+	if err != nil {
+		return err
+	}
+	var results []PingResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return err
+	}
+
+	lastRun.Lock()
+	lastRun.results = results
+	lastRun.completedAt = info.ModTime()
+	lastRun.Unlock()
+
+	staleCache.Lock()
+	staleCache.results = results
+	staleCache.completedAt = info.ModTime()
+	staleCache.Unlock()
+	return nil
+}
+
+// takeStaleRun returns the restored run the first time it is called after
+// startup, so the first page load shows results straight away. Later
+// streams run fresh pings.
+func takeStaleRun() (results []PingResult, completedAt time.Time, ok bool) {
+	staleCache.Lock()
+	defer staleCache.Unlock()
+	results, completedAt = staleCache.results, staleCache.completedAt
+	staleCache.results = nil
+	return results, completedAt, results != nil
+}
+
+// cachedResults sends the restored results without delay.
+func cachedResults(recorded []PingResult) <-chan PingResult {
+	results := make(chan PingResult, len(recorded))
+	for _, result := range recorded {
+		results <- result
+	}
+	close(results)
+	return results
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var stunServer = flag.String("stun-server", "", "STUN server URL handed to browsers for peer-to-peer latency, e.g. stun:stun.l.google.com:19302")
+
+const (
+	// rtcRoomTTL is how long a P2P room's offer and answer are kept.
+	rtcRoomTTL = 5 * time.Minute
+	// rtcMaxSDPBytes bounds a posted session description.
+	rtcMaxSDPBytes = 64 << 10
+	// rtcMaxRooms and rtcMaxRoomsPerClient bound the live rooms overall and
+	// per client address, so unauthenticated offers can't grow memory
+	// without limit.
+	rtcMaxRooms          = 1000
+	rtcMaxRoomsPerClient = 10
+)
+
+// rtcRoom holds the SDP exchanged by the two browsers of one P2P session.
+// ICE candidates are gathered before posting, so no trickle exchange is
+// needed and the server never sees any media.
+type rtcRoom struct {
+	offer   string
+	answer  string
+	created time.Time
+	// client is the address of the browser that posted the offer.
+	client string
+}
+
+var rtcRooms struct {
+	sync.Mutex
+	rooms map[string]*rtcRoom
+}
+
+// rtcRoomFor returns the room with the given name, dropping expired rooms
+// first. rtcRooms must be locked.
+func rtcRoomFor(name string) *rtcRoom {
+	now := time.Now()
+	for key, room := range rtcRooms.rooms {
+		if now.Sub(room.created) > rtcRoomTTL {
+			delete(rtcRooms.rooms, key)
+		}
+	}
+	return rtcRooms.rooms[name]
+}
+
+// newRTCRoom starts the named room over for client, or returns nil if that
+// would exceed rtcMaxRooms or client's rtcMaxRoomsPerClient. rtcRooms must
+// be locked.
+func newRTCRoom(name, client string) *rtcRoom {
+	rtcRoomFor(name)
+	delete(rtcRooms.rooms, name)
+	if len(rtcRooms.rooms) >= rtcMaxRooms {
+		return nil
+	}
+	clientRooms := 0
+	for _, room := range rtcRooms.rooms {
+		if room.client == client {
+			clientRooms++
+		}
+	}
+	if clientRooms >= rtcMaxRoomsPerClient {
+		return nil
+	}
+
+	if rtcRooms.rooms == nil {
+		rtcRooms.rooms = make(map[string]*rtcRoom)
+	}
+	room := &rtcRoom{created: time.Now(), client: client}
+	rtcRooms.rooms[name] = room
+	return room
+}
+
+// rtcHandler serves one side of the SDP exchange: POST stores a description
+// for the room and GET fetches it, answering 404 until the peer has posted.
+// Posting an offer starts the room over.
+func rtcHandler(answer bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			name := r.URL.Query().Get("room")
+			rtcRooms.Lock()
+			defer rtcRooms.Unlock()
+			room := rtcRoomFor(name)
+			sdp := ""
+			if room != nil {
+				sdp = room.offer
+				if answer {
+					sdp = room.answer
+				}
+			}
+			if sdp == "" {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "nothing posted for this room yet"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"room": name, "sdp": sdp})
+
+		case http.MethodPost:
+			var body struct {
+				Room string `json:"room"`
+				SDP  string `json:"sdp"`
+			}
+			if err := json.NewDecoder(io.LimitReader(r.Body, rtcMaxSDPBytes)).Decode(&body); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+				return
+			}
+			if body.Room == "" || body.SDP == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "room and sdp are required"})
+				return
+			}
+			rtcRooms.Lock()
+			defer rtcRooms.Unlock()
+			if !answer {
+				client, _, _ := net.SplitHostPort(r.RemoteAddr)
+				room := newRTCRoom(body.Room, client)
+				if room == nil {
+					writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many open rooms; try again in a few minutes"})
+					return
+				}
+				room.offer = body.SDP
+			} else if room := rtcRoomFor(body.Room); room != nil && room.offer != "" {
+				room.answer = body.SDP
+			} else {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "no offer for this room"})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+		}
+	}
+}
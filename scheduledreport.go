@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	smtpHost       = flag.String("smtp-host", "", "SMTP server for scheduled reports; reports are disabled when empty")
+	smtpPort       = flag.Int("smtp-port", 587, "SMTP server port")
+	smtpFrom       = flag.String("smtp-from", "", "sender address for scheduled reports, also used as the SMTP username")
+	smtpTo         = flag.String("smtp-to", "", "comma-separated recipients for scheduled reports")
+	smtpPassword   = flag.String("smtp-password", "", "SMTP password; authentication is skipped when empty")
+	reportSchedule = flag.String("report-schedule", "0 8 * * *", "cron expression for scheduled reports")
+)
+
+// startScheduledReports runs a fresh ping sweep whenever the schedule fires
+// and emails the resulting report.
+func startScheduledReports(schedule *cronSchedule) {
+	go func() {
+		for {
+			next := schedule.next(time.Now())
+			if next.IsZero() {
+				log.Printf("Report schedule %q never fires, scheduled reports disabled", *reportSchedule)
+				return
+			}
+			log.Printf("Next scheduled report at %s", next.Format(time.RFC3339))
+			time.Sleep(time.Until(next))
+			sendScheduledReport()
+		}
+	}()
+}
+
+// validateSMTPFlags checks the --smtp-* flags up front, so a bad setting
+// fails at startup rather than when the first report is due.
+func validateSMTPFlags() error {
+	if *smtpPort <= 0 || *smtpPort > 65535 {
+		return fmt.Errorf("--smtp-port %d is not a valid port", *smtpPort)
+	}
+	if *smtpFrom == "" {
+		return fmt.Errorf("--smtp-from is required with --smtp-host")
+	}
+	if len(smtpRecipients()) == 0 {
+		return fmt.Errorf("--smtp-to needs at least one recipient")
+	}
+	return nil
+}
+
+// smtpRecipients returns the addresses listed in --smtp-to.
+func smtpRecipients() []string {
+	var recipients []string
+	for _, addr := range strings.Split(*smtpTo, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			recipients = append(recipients, addr)
+		}
+	}
+	return recipients
+}
+
+func sendScheduledReport() {
+	log.Println("Starting scheduled report run...")
+
+	// The run takes one of --max-concurrent-runs slots like a /ping stream.
+	acquireRunSlot(context.Background(), func(position int) {
+		log.Printf("Scheduled report queued for a run slot at position %d", position)
+	})
+	var completed []PingResult
+	for result := range runPings(context.Background(), getRegions(), runOptions{}) {
+		result.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		completed = append(completed, result)
+	}
+	completedAt := time.Now()
+	finishRun(completed)
+	releaseRunSlot()
+
+	var report bytes.Buffer
+	if err := renderReport(&report, completed, completedAt); err != nil {
+		log.Printf("Error rendering scheduled report: %v", err)
+		return
+	}
+
+	if err := emailReport(report.Bytes(), completedAt); err != nil {
+		log.Printf("Error sending scheduled report: %v", err)
+		return
+	}
+	log.Printf("Scheduled report sent to %s", *smtpTo)
+}
+
+// emailReport sends the report as an HTML attachment to every recipient.
+func emailReport(report []byte, completedAt time.Time) error {
+	recipients := smtpRecipients()
+
+	boundary := newUUID()
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", *smtpFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: AWS latency report %s\r\n", completedAt.Format("2006-01-02"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", completedAt.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&msg, "--%s\r\n", boundary)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "AWS region latency report for the run completed at %s is attached.\r\n\r\n",
+		completedAt.Format(time.RFC1123))
+
+	fmt.Fprintf(&msg, "--%s\r\n", boundary)
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n")
+	msg.WriteString("Content-Disposition: attachment; filename=\"aws-ping-report.html\"\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(report)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	fmt.Fprintf(&msg, "--%s--\r\n", boundary)
+
+	var auth smtp.Auth
+	if *smtpPassword != "" {
+		auth = smtp.PlainAuth("", *smtpFrom, *smtpPassword, *smtpHost)
+	}
+	addr := net.JoinHostPort(*smtpHost, strconv.Itoa(*smtpPort))
+	return smtp.SendMail(addr, auth, *smtpFrom, recipients, msg.Bytes())
+}
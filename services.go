@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+// matrixServices are the AWS service endpoints pinged by /api/services.
+var matrixServices = []string{"ec2", "s3", "rds", "lambda"}
+
+// ServiceMatrix maps region code to service name to latency in milliseconds.
+// Endpoints that could not be reached are left out.
+type ServiceMatrix map[string]map[string]float64
+
+// serviceEndpointURL returns the regional endpoint of an AWS service. It
+// follows endpointURL so partitions on other domains are handled too.
+func serviceEndpointURL(service string, region awsping.AWSRegion) string {
+	return strings.Replace(endpointURL(region), "://s3.", "://"+service+".", 1)
+}
+
+// pingService returns the fastest of pingAttempts HEAD requests to a service
+// endpoint. Any HTTP response counts, as most services answer HEAD / with an
+// error status.
+func pingService(ctx context.Context, service string, region awsping.AWSRegion) (time.Duration, bool) {
+	var fastest time.Duration
+	for i := 0; i < pingAttempts; i++ {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", serviceEndpointURL(service, region), nil)
+		if err != nil {
+			return 0, false
+		}
+		start := time.Now()
+		resp, err := pingHTTPClient().Do(req)
+		if err != nil {
+			continue
+		}
+		latency := time.Since(start)
+		resp.Body.Close()
+		if fastest == 0 || latency < fastest {
+			fastest = latency
+		}
+	}
+	return fastest, fastest != 0
+}
+
+func servicesHandler(w http.ResponseWriter, r *http.Request) {
+	if !acquireRunSlot(r.Context(), func(int) {}) {
+		return
+	}
+	defer releaseRunSlot()
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(float64(responseTimeout()*pingAttempts)*1.1))
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	matrix := make(ServiceMatrix)
+	for _, region := range getRegions() {
+		if strings.HasPrefix(region.Code, consulCodePrefix) {
+			continue
+		}
+		for _, service := range matrixServices {
+			wg.Add(1)
+			go func(region awsping.AWSRegion, service string) {
+				defer wg.Done()
+				latency, ok := pingService(ctx, service, region)
+				if !ok {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if matrix[region.Code] == nil {
+					matrix[region.Code] = make(map[string]float64, len(matrixServices))
+				}
+				matrix[region.Code][service] = float64(latency) / float64(time.Millisecond)
+			}(region, service)
+		}
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, matrix)
+}
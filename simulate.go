@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const earthRadiusKm = 6371.0
+
+type SimulatedRegion struct {
+	Region            string  `json:"region"`
+	Code              string  `json:"code"`
+	DistanceKm        float64 `json:"distanceKm"`
+	EstimatedMinRTTMs float64 `json:"estimatedMinRTTMs"`
+}
+
+// greatCircleKm returns the haversine distance between two points.
+func greatCircleKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// simulateHandler ranks regions by distance from a given lat/lon. The RTT
+// estimate of 1ms per 100km is a lower bound from the speed of light in fibre.
+func simulateHandler(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		http.Error(w, "lat must be a number between -90 and 90", http.StatusBadRequest)
+		return
+	}
+	lon, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		http.Error(w, "lon must be a number between -180 and 180", http.StatusBadRequest)
+		return
+	}
+
+	regions := getRegions()
+	simulated := make([]SimulatedRegion, 0, len(regions))
+	for _, region := range regions {
+		loc, ok := regionLocations[region.Code]
+		if !ok {
+			continue
+		}
+		distance := greatCircleKm(lat, lon, loc.Lat, loc.Lon)
+		simulated = append(simulated, SimulatedRegion{
+			Region:            region.Name,
+			Code:              region.Code,
+			DistanceKm:        math.Round(distance),
+			EstimatedMinRTTMs: math.Round(distance/100*100) / 100,
+		})
+	}
+	sort.Slice(simulated, func(i, j int) bool {
+		return simulated[i].DistanceKm < simulated[j].DistanceKm
+	})
+
+	writeJSON(w, http.StatusOK, simulated)
+}
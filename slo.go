@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sloDefinitions holds the --slo objectives.
+var sloDefinitions sloList
+
+func init() {
+	flag.Var(&sloDefinitions, "slo", "latency SLO as <region>:<max_latency_ms>:<window_days> (repeatable)")
+}
+
+type slo struct {
+	region      string
+	maxMs       float64
+	windowDays  int
+	measurement []sloMeasurement
+}
+
+type sloMeasurement struct {
+	at      time.Time
+	passing bool
+}
+
+// sloList is a repeatable flag.Value of SLO definitions.
+type sloList []*slo
+
+func (l *sloList) String() string {
+	parts := make([]string, len(*l))
+	for i, s := range *l {
+		parts[i] = fmt.Sprintf("%s:%g:%d", s.region, s.maxMs, s.windowDays)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *sloList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return fmt.Errorf("expected <region>:<max_latency_ms>:<window_days>, got %q", value)
+	}
+	maxMs, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || maxMs <= 0 {
+		return fmt.Errorf("invalid max_latency_ms %q", parts[1])
+	}
+	windowDays, err := strconv.Atoi(parts[2])
+	if err != nil || windowDays <= 0 {
+		return fmt.Errorf("invalid window_days %q", parts[2])
+	}
+	*l = append(*l, &slo{region: parts[0], maxMs: maxMs, windowDays: windowDays})
+	return nil
+}
+
+// sloMu guards the measurements of every SLO. They are kept in memory only,
+// so compliance restarts from scratch with the server.
+var sloMu sync.Mutex
+
+type SLOCompliance struct {
+	Region              string  `json:"region"`
+	ThresholdMs         float64 `json:"threshold_ms"`
+	WindowDays          int     `json:"window_days"`
+	MeasurementsTotal   int     `json:"measurements_total"`
+	MeasurementsPassing int     `json:"measurements_passing"`
+	CompliancePct       float64 `json:"compliance_pct"`
+}
+
+// recordSLOs adds one pass/fail measurement per SLO from a completed run and
+// drops measurements that have left their window. A failed or missing
+// region counts as failing.
+func recordSLOs(results []PingResult) {
+	byCode := make(map[string]PingResult, len(results))
+	for _, result := range results {
+		byCode[result.Code] = result
+	}
+
+	sloMu.Lock()
+	defer sloMu.Unlock()
+
+	now := time.Now()
+	for _, s := range sloDefinitions {
+		result, ok := byCode[s.region]
+		passing := ok && result.Error == "" && result.Latency <= s.maxMs
+		s.measurement = append(s.prune(now), sloMeasurement{at: now, passing: passing})
+	}
+}
+
+// prune returns the measurements still inside the SLO window.
+func (s *slo) prune(now time.Time) []sloMeasurement {
+	cutoff := now.AddDate(0, 0, -s.windowDays)
+	i := 0
+	for i < len(s.measurement) && s.measurement[i].at.Before(cutoff) {
+		i++
+	}
+	return s.measurement[i:]
+}
+
+func sloHandler(w http.ResponseWriter, r *http.Request) {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+
+	now := time.Now()
+	compliance := make([]SLOCompliance, 0, len(sloDefinitions))
+	for _, s := range sloDefinitions {
+		s.measurement = s.prune(now)
+		c := SLOCompliance{
+			Region:            s.region,
+			ThresholdMs:       s.maxMs,
+			WindowDays:        s.windowDays,
+			MeasurementsTotal: len(s.measurement),
+		}
+		for _, m := range s.measurement {
+			if m.passing {
+				c.MeasurementsPassing++
+			}
+		}
+		if c.MeasurementsTotal > 0 {
+			c.CompliancePct = math.Round(float64(c.MeasurementsPassing)/float64(c.MeasurementsTotal)*10000) / 100
+		}
+		compliance = append(compliance, c)
+	}
+
+	writeJSON(w, http.StatusOK, compliance)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var (
+	speedTest       = flag.Bool("speed-test", false, "download a test object from each region after pinging it to measure throughput")
+	speedTestObject = flag.String("speed-test-object", "", "URL of the ~1MB speed test object; {region} is replaced with the region code")
+)
+
+// speedTestMaxBytes caps how much of the test object is downloaded.
+const speedTestMaxBytes = 4 << 20
+
+// AWS publishes no public test objects, so the speed test downloads from a
+// bucket the operator owns. Create one bucket per region, e.g.
+// "speedtest-<region>", upload a ~1MB object with public read access and
+// pass --speed-test-object "https://speedtest-{region}.s3.{region}.amazonaws.com/1MB.bin".
+// Regions without the object answer 403 or 404 and are skipped.
+
+// speedTestURL returns the test object URL for a region.
+func speedTestURL(region awsping.AWSRegion) string {
+	return strings.ReplaceAll(*speedTestObject, "{region}", region.Code)
+}
+
+// measureThroughput downloads the region's test object and returns the
+// throughput in Mbit/s. ok is false when the region has no test object.
+func measureThroughput(ctx context.Context, region awsping.AWSRegion) (mbps float64, ok bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", speedTestURL(region), nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	start := time.Now()
+	resp, err := pingHTTPClient().Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, nil
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, speedTestMaxBytes))
+	if err != nil {
+		return 0, false, fmt.Errorf("downloading test object: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	return float64(n) * 8 / 1e6 / elapsed.Seconds(), true, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/ekalinin/awsping"
+)
+
+var tlsResumptionTest = flag.Bool("tls-resumption-test", false, "open two fresh TLS connections to each region to measure the benefit of session resumption")
+
+// errNoTLSHandshake is returned for targets that aren't served over TLS.
+var errNoTLSHandshake = errors.New("no TLS handshake")
+
+// tlsHandshakeTime sends one HEAD request and returns how long its TLS
+// handshake took and whether the session was resumed.
+func tlsHandshakeTime(ctx context.Context, client *http.Client, region awsping.AWSRegion) (time.Duration, bool, error) {
+	var start time.Time
+	var handshake time.Duration
+	var resumed bool
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			start = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				handshake = time.Since(start)
+				resumed = state.DidResume
+			}
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "HEAD", endpointURL(region), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, *headBodyLimit))
+	resp.Body.Close()
+	if handshake == 0 {
+		return 0, false, errNoTLSHandshake
+	}
+	return handshake, resumed, nil
+}
+
+// measureTLSResumption times a full TLS handshake to a region and then a
+// second one on a new connection from the same transport, which can resume
+// the first session. Keep-alives are off so that the second request can't
+// reuse the first connection.
+func measureTLSResumption(ctx context.Context, region awsping.AWSRegion) (first, resumed time.Duration, err error) {
+	client := newPingClient(*bindIP)
+	transport := client.Transport.(*http.Transport)
+	transport.DisableKeepAlives = true
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	if first, _, err = tlsHandshakeTime(ctx, client, region); err != nil {
+		return 0, 0, err
+	}
+	second, didResume, err := tlsHandshakeTime(ctx, client, region)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !didResume {
+		log.Printf("TLS session to %s was not resumed", region.Code)
+	}
+	return first, second, nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ekalinin/awsping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	tracerouteMaxHops = 30
+	// tracerouteProbes is how many echoes are sent per hop; the fastest
+	// reply is reported.
+	tracerouteProbes       = 3
+	tracerouteProbeTimeout = time.Second
+)
+
+// TracerouteHop is sent as a hop SSE event for each TTL. IP is empty and
+// RTTMs nil when no probe got an answer.
+type TracerouteHop struct {
+	Hop      int      `json:"hop"`
+	IP       string   `json:"ip"`
+	Hostname string   `json:"hostname"`
+	RTTMs    *float64 `json:"rtt_ms"`
+}
+
+// TracerouteComplete is sent as the traceroute_complete SSE event. Reached
+// is set once a hop answered from the destination or from one of the
+// region's published prefixes.
+type TracerouteComplete struct {
+	Destination string `json:"destination"`
+	Reached     bool   `json:"reached"`
+}
+
+// regionPrefixes returns every prefix ip-ranges.json lists for the region,
+// across services.
+func regionPrefixes(code string) ([]*net.IPNet, error) {
+	ranges, err := fetchIPRanges()
+	if err != nil {
+		return nil, err
+	}
+	var nets []*net.IPNet
+	for _, prefix := range ranges.Prefixes {
+		if prefix.Region != code {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(prefix.IPPrefix); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets, nil
+}
+
+// probeHop sends one echo with the given TTL and returns who answered: a
+// router's "time exceeded" or the destination's echo reply.
+func probeHop(conn *icmp.PacketConn, dst net.IP, ttl int) (net.IP, time.Duration, bool, error) {
+	if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return nil, 0, false, err
+	}
+	id := os.Getpid() & 0xffff
+	seq := int(icmpRegionSeq.Add(1) & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("TRACE")},
+	}
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(tracerouteProbeTimeout)); err != nil {
+		return nil, 0, false, err
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(msgBytes, &net.IPAddr{IP: dst}); err != nil {
+		return nil, 0, false, err
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, 0, false, nil
+			}
+			return nil, 0, false, err
+		}
+		elapsed := time.Since(start)
+		ip, ok := peer.(*net.IPAddr)
+		if !ok {
+			continue
+		}
+		msg, err := icmp.ParseMessage(1, reply[:n])
+		if err != nil {
+			continue
+		}
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if msg.Type == ipv4.ICMPTypeEchoReply && ip.IP.Equal(dst) && body.ID == id && body.Seq == seq {
+				return ip.IP, elapsed, true, nil
+			}
+		case *icmp.TimeExceeded:
+			if quotesEcho(body.Data, id, seq) {
+				return ip.IP, elapsed, false, nil
+			}
+		}
+	}
+}
+
+// traceHop sends tracerouteProbes echoes with the given TTL and reports the
+// fastest answer.
+func traceHop(ctx context.Context, conn *icmp.PacketConn, dst net.IP, ttl int) (TracerouteHop, bool, error) {
+	hop := TracerouteHop{Hop: ttl}
+	var fastest time.Duration
+	var from net.IP
+	reached := false
+	for i := 0; i < tracerouteProbes; i++ {
+		ip, rtt, atDestination, err := probeHop(conn, dst, ttl)
+		if err != nil {
+			return hop, false, err
+		}
+		if ip != nil && (from == nil || rtt < fastest) {
+			from, fastest = ip, rtt
+		}
+		reached = reached || atDestination
+	}
+	if from == nil {
+		return hop, false, nil
+	}
+
+	hop.IP = from.String()
+	ms := float64(fastest) / float64(time.Millisecond)
+	hop.RTTMs = &ms
+	lookupCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if names, err := net.DefaultResolver.LookupAddr(lookupCtx, hop.IP); err == nil && len(names) > 0 {
+		hop.Hostname = strings.TrimSuffix(names[0], ".")
+	}
+	return hop, reached, nil
+}
+
+// tracerouteHandler streams a traceroute to the region's S3 endpoint, one
+// hop SSE event per TTL, up to tracerouteMaxHops or the first hop inside
+// the region's published prefixes. Probes are ICMP echoes: unprivileged UDP
+// probes would still need a raw ICMP socket to hear the "time exceeded"
+// replies, so either way it needs root or CAP_NET_RAW.
+func tracerouteHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("region_code")
+	var region awsping.AWSRegion
+	found := false
+	for _, candidate := range getRegions() {
+		if candidate.Code == code && !strings.HasPrefix(code, consulCodePrefix) {
+			region, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown region " + code})
+		return
+	}
+	if !icmpAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "traceroute needs raw ICMP sockets (root or CAP_NET_RAW)"})
+		return
+	}
+
+	addrs, err := net.DefaultResolver.LookupIP(r.Context(), "ip4", regionHostname(region))
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "resolving endpoint: " + err.Error()})
+		return
+	}
+	dst := addrs[0]
+
+	listenAddr := "0.0.0.0"
+	if icmpSourceIP != "" {
+		listenAddr = icmpSourceIP
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", listenAddr)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer conn.Close()
+
+	prefixes, err := regionPrefixes(code)
+	if err != nil {
+		log.Printf("Error loading AWS IP ranges, tracing to the endpoint only: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Tracing route to %s (%s)", code, dst)
+	complete := TracerouteComplete{Destination: dst.String()}
+	for ttl := 1; ttl <= tracerouteMaxHops && r.Context().Err() == nil; ttl++ {
+		hop, atDestination, err := traceHop(r.Context(), conn, dst, ttl)
+		if err != nil {
+			log.Printf("Error tracing route to %s: %v", code, err)
+			break
+		}
+		writeSSEEvent(w, flusher, "hop", hop)
+		if atDestination || hop.IP != "" && inPrefixes(net.ParseIP(hop.IP), prefixes) {
+			complete.Reached = true
+			break
+		}
+	}
+	writeSSEEvent(w, flusher, "traceroute_complete", complete)
+}
+
+// traceroutePage lets the user pick a region and watch its traceroute
+// arrive hop by hop, drawn as a chain of arrows below the table.
+var traceroutePage = template.Must(template.New("traceroute").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>AWS Region Traceroute</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 1200px; margin: 0 auto; padding: 20px; background: #f5f5f5; }
+.controls { margin-bottom: 20px; }
+.controls button, .controls select { padding: 8px 16px; font-size: 14px; }
+#status { margin-left: 10px; color: #666; }
+table { width: 100%; border-collapse: collapse; background: white; box-shadow: 0 1px 3px rgba(0,0,0,0.1); border-radius: 4px; }
+th, td { padding: 12px; text-align: left; border-bottom: 1px solid #eee; }
+th { background: #f8f9fa; font-weight: 600; }
+.latency { font-family: monospace; font-size: 14px; }
+.timeout { color: #999; }
+#path { margin-top: 20px; background: white; box-shadow: 0 1px 3px rgba(0,0,0,0.1); border-radius: 4px; }
+#path rect { fill: #e9f2ff; stroke: #007bff; }
+#path rect.timeout { fill: #f8f9fa; stroke: #ccc; stroke-dasharray: 4 2; }
+#path line { stroke: #666; stroke-width: 1.5; marker-end: url(#arrow); }
+#path text { font-size: 11px; text-anchor: middle; }
+</style>
+</head>
+<body>
+<h1>Traceroute</h1>
+<div class="controls">
+<select id="region">{{range .}}<option value="{{.Code}}">{{.Name}} ({{.Code}})</option>{{end}}</select>
+<button id="start" type="button">Trace</button>
+<span id="status"></span>
+</div>
+<table id="hops">
+<thead><tr><th>Hop</th><th>IP</th><th>Hostname</th><th>RTT</th></tr></thead>
+<tbody></tbody>
+</table>
+<svg id="path" width="100%" height="0"></svg>
+<script>
+const tbody = document.querySelector('#hops tbody');
+const status = document.getElementById('status');
+const svg = document.getElementById('path');
+const svgNS = 'http://www.w3.org/2000/svg';
+const boxWidth = 150, boxHeight = 44, gap = 40, perRow = 6;
+let source;
+
+function svgElement(name, attrs) {
+    const el = document.createElementNS(svgNS, name);
+    Object.entries(attrs).forEach(([key, value]) => el.setAttribute(key, value));
+    return el;
+}
+
+function resetPath() {
+    svg.replaceChildren();
+    const marker = svgElement('marker', { id: 'arrow', viewBox: '0 0 10 10', refX: 10, refY: 5, markerWidth: 6, markerHeight: 6, orient: 'auto' });
+    marker.appendChild(svgElement('path', { d: 'M 0 0 L 10 5 L 0 10 z', fill: '#666' }));
+    const defs = svgElement('defs', {});
+    defs.appendChild(marker);
+    svg.appendChild(defs);
+    svg.setAttribute('height', 0);
+}
+
+// Hops snake left to right, perRow to a line, each joined to the previous
+// one by an arrow.
+function boxPosition(index) {
+    const row = Math.floor(index / perRow);
+    const column = index % perRow;
+    return { x: 10 + column * (boxWidth + gap), y: 10 + row * (boxHeight + gap) };
+}
+
+function drawHop(hop, index) {
+    const { x, y } = boxPosition(index);
+    if (index > 0) {
+        const previous = boxPosition(index - 1);
+        const sameRow = previous.y === y;
+        svg.appendChild(svgElement('line', sameRow
+            ? { x1: previous.x + boxWidth, y1: y + boxHeight / 2, x2: x, y2: y + boxHeight / 2 }
+            : { x1: previous.x + boxWidth / 2, y1: previous.y + boxHeight, x2: x + boxWidth / 2, y2: y }));
+    }
+    svg.appendChild(svgElement('rect', { x: x, y: y, width: boxWidth, height: boxHeight, rx: 4, class: hop.ip ? '' : 'timeout' }));
+    const label = svgElement('text', { x: x + boxWidth / 2, y: y + 18 });
+    label.textContent = hop.hop + ': ' + (hop.ip || '*');
+    svg.appendChild(label);
+    const rtt = svgElement('text', { x: x + boxWidth / 2, y: y + 34 });
+    rtt.textContent = hop.rtt_ms === null ? 'no reply' : hop.rtt_ms.toFixed(2) + ' ms';
+    svg.appendChild(rtt);
+    svg.setAttribute('height', y + boxHeight + 10);
+}
+
+document.getElementById('start').addEventListener('click', () => {
+    if (source) source.close();
+    tbody.innerHTML = '';
+    resetPath();
+    const code = document.getElementById('region').value;
+    status.textContent = 'Tracing ' + code + '...';
+    let count = 0;
+    source = new EventSource('/traceroute/' + encodeURIComponent(code));
+    source.addEventListener('hop', (event) => {
+        const hop = JSON.parse(event.data);
+        const tr = tbody.insertRow();
+        tr.insertCell().textContent = hop.hop;
+        tr.insertCell().textContent = hop.ip || '*';
+        tr.insertCell().textContent = hop.hostname;
+        const rttCell = tr.insertCell();
+        rttCell.className = hop.ip ? 'latency' : 'latency timeout';
+        rttCell.textContent = hop.rtt_ms === null ? 'no reply' : hop.rtt_ms.toFixed(2) + ' ms';
+        drawHop(hop, count++);
+    });
+    source.addEventListener('traceroute_complete', (event) => {
+        const complete = JSON.parse(event.data);
+        status.textContent = complete.reached
+            ? 'Reached ' + code + ' in ' + count + ' hops'
+            : 'Stopped after ' + count + ' hops without reaching ' + complete.destination;
+        source.close();
+    });
+    source.onerror = () => {
+        status.textContent = 'Traceroute failed; the server may lack raw socket access';
+        source.close();
+    };
+});
+</script>
+</body>
+</html>
+`))
+
+func traceroutePageHandler(w http.ResponseWriter, r *http.Request) {
+	var regions []awsping.AWSRegion
+	for _, region := range getRegions() {
+		if !strings.HasPrefix(region.Code, consulCodePrefix) {
+			regions = append(regions, region)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := traceroutePage.Execute(w, regions); err != nil {
+		log.Printf("Error rendering traceroute page: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// TransportConfig describes how ping connections are set up.
+type TransportConfig struct {
+	ConnectTimeoutMs  int  `json:"connect_timeout_ms"`
+	ResponseTimeoutMs int  `json:"response_timeout_ms"`
+	KeepAliveMs       int  `json:"keepalive_interval_ms"`
+	KeepAliveDisabled bool `json:"keepalive_disabled"`
+}
+
+// versionHandler reports the build, the server's AWS region if known and the
+// ping transport's settings.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version":       version,
+		"go_version":    runtime.Version(),
+		"server_region": serverRegion,
+		"transport_config": TransportConfig{
+			ConnectTimeoutMs:  *connectTimeoutMs,
+			ResponseTimeoutMs: *responseTimeoutMs,
+			KeepAliveMs:       *keepAliveIntervalMs,
+			KeepAliveDisabled: *keepAliveDisable,
+		},
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	onCompleteWebhook = flag.String("on-complete-webhook", "", "URL to POST every completed run's results to")
+	webhookSecret     = flag.String("webhook-secret", "", "secret for the X-Hub-Signature-256 HMAC on --on-complete-webhook requests")
+)
+
+// onCompleteRetries is how many times a 5xx response is retried.
+const onCompleteRetries = 3
+
+// signPayload returns the GitHub-style "sha256=<hex>" HMAC of data.
+func signPayload(data []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postRunComplete sends the run's results to the completion webhook,
+// retrying server errors with exponential backoff.
+func postRunComplete(results []PingResult) {
+	data, err := json.Marshal(results)
+	if err != nil {
+		log.Printf("Error marshaling completion webhook payload: %v", err)
+		return
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", *onCompleteWebhook, bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Error creating completion webhook request: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if *webhookSecret != "" {
+			req.Header.Set("X-Hub-Signature-256", signPayload(data, *webhookSecret))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Error posting completion webhook: %v", err)
+			return
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		log.Printf("Completion webhook returned %s", resp.Status)
+		switch {
+		case resp.StatusCode >= 500 && attempt < onCompleteRetries:
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			log.Printf("Completion webhook response body: %s", body)
+		}
+		return
+	}
+}